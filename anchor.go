@@ -0,0 +1,130 @@
+package logexp
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Anchor int32 // 锚定的位置，可以按位组合
+const (
+	Anchor_Prefix Anchor = 1 << iota // 关键词出现在行首，写法：^GET
+	Anchor_Suffix                    // 关键词出现在行尾，写法：.json$
+
+	Anchor_Exact = Anchor_Prefix | Anchor_Suffix // 整行等于关键词，写法：=exact text 或者 ^exact text$
+)
+
+/*
+ * 锚定表达式：关键词必须出现在行首、行尾，或者跟整行相同
+ * 文本有多行时，任意一行满足即算匹配；行尾的'\r'被忽略
+ */
+type ExpressionAnchor struct {
+	Type       ExpressionType `json:"type"`
+	IsNegative bool           `json:"is_negative"` // 是否取非
+	Keyword    string         `json:"keyword"`     // 关键词
+	Anchor     Anchor         `json:"anchor"`      // 锚定的位置
+	syntax     Syntax         // 编译时的语法，决定文本形式中关键词的写法
+}
+
+func (e *ExpressionAnchor) GetIsNegative() bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionAnchor) GetType() ExpressionType {
+	return e.Type
+}
+
+func (e *ExpressionAnchor) GetExps() []IExpression {
+	return nil
+}
+
+func (e *ExpressionAnchor) Match(text string) bool {
+	res := e.find(text) >= 0
+	if e.IsNegative {
+		res = !res
+	}
+	return res
+}
+
+// 返回第一个满足条件的行的位置，没有时返回-1
+func (e *ExpressionAnchor) find(text string) int {
+	for start := 0; start <= len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		line := strings.TrimSuffix(text[start:end], "\r")
+		var ok bool
+		switch e.Anchor {
+		case Anchor_Prefix:
+			ok = strings.HasPrefix(line, e.Keyword)
+		case Anchor_Suffix:
+			ok = strings.HasSuffix(line, e.Keyword)
+		case Anchor_Exact:
+			ok = line == e.Keyword
+		}
+		if ok {
+			if e.Anchor == Anchor_Suffix {
+				return start + len(line) - len(e.Keyword)
+			}
+			return start
+		}
+		start = end + 1
+	}
+	return -1
+}
+
+func (e *ExpressionAnchor) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionAnchor) String() string {
+	s := quoteKeyword(e.Keyword, e.syntax)
+	switch e.Anchor {
+	case Anchor_Prefix:
+		s = "^" + s
+	case Anchor_Suffix:
+		s = s + "$"
+	case Anchor_Exact:
+		s = "=" + s
+	}
+	if e.IsNegative {
+		return "!" + s
+	}
+	return s
+}
+
+// 说明满足条件的位置
+func (e *ExpressionAnchor) explain(text string) string {
+	if i := e.find(text); i >= 0 {
+		return fmt.Sprintf("found at offset %v", i)
+	}
+	return "not found"
+}
+
+/*
+ * 拆分关键词两端的锚定符号：开头的'^'、'='，结尾的'$'
+ * 去掉锚定符号后关键词为空时，当作普通的关键词
+ */
+func splitAnchor(exp []rune) ([]rune, Anchor) {
+	var anchor Anchor
+	body := exp
+	if len(body) > 1 && body[0] == '=' {
+		return body[1:], Anchor_Exact
+	}
+	if len(body) > 0 && body[0] == '^' {
+		anchor |= Anchor_Prefix
+		body = body[1:]
+	}
+	if len(body) > 0 && body[len(body)-1] == '$' {
+		anchor |= Anchor_Suffix
+		body = body[:len(body)-1]
+	}
+	if len(body) == 0 {
+		return exp, 0
+	}
+	return body, anchor
+}
@@ -0,0 +1,213 @@
+package logexp
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// 并发批量匹配时，每个goroutine一次领取的文本条数
+const batchChunkSize = 256
+
+/*
+ * 把[0, n)分成若干块，由concurrency个goroutine并发处理，所有块处理完才返回
+ * concurrency<=0时使用GOMAXPROCS个goroutine；只有一块或者concurrency为1时在当前goroutine中处理
+ */
+func parallel(n int, concurrency int, work func(start, end int)) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	chunks := (n + batchChunkSize - 1) / batchChunkSize
+	if concurrency > chunks {
+		concurrency = chunks
+	}
+	if concurrency <= 1 {
+		if n > 0 {
+			work(0, n)
+		}
+		return
+	}
+	var next int64
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				start := int(atomic.AddInt64(&next, batchChunkSize)) - batchChunkSize
+				if start >= n {
+					return
+				}
+				end := start + batchChunkSize
+				if end > n {
+					end = n
+				}
+				work(start, end)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+/*
+ * 规则集：一组命名的表达式，一条文本同时跟所有规则匹配
+ * 同一种规范化方式下，所有规则里相同的关键词对每条文本只查找一次，结果在规则之间共用；每种规范化方式对每条文本只做一次
+ * 单个表达式逐条调用Match即可，Match不分配内存；需要并发批量匹配时，可以用只有一条规则的RuleSet
+ * RuleSet可以被多个goroutine并发使用
+ */
+type RuleSet struct {
+	mu       sync.RWMutex
+	names    []string
+	rules    []*LogExp
+	groups   []ruleGroup // 按规范化方式分组的规则
+	keywords int         // 所有分组的关键词总数，即查找结果的备忘录的大小
+}
+
+// 规范化方式相同的一组规则
+type ruleGroup struct {
+	fold  Fold
+	rules []int     // 规则在RuleSet中的下标
+	ids   [][]int32 // 每条规则的指令序列中的关键词 -> 关键词在备忘录中的下标
+}
+
+func NewRuleSet() *RuleSet {
+	return &RuleSet{}
+}
+
+/*
+ * @Param name: 规则的名字，已经存在时替换原来的规则，位置不变
+ * @Param exp: 编译好的表达式
+ */
+func (s *RuleSet) Add(name string, exp *LogExp) *CstError {
+	if name == "" {
+		return newCstError(ErrCodeInvalidExpression, "invalid rule name: %v", name)
+	}
+	if exp == nil {
+		return newCstError(ErrCodeInvalidExpression, "expression of %v is nil", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replaced := false
+	for i := range s.names {
+		if s.names[i] == name {
+			s.rules[i] = exp
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.names = append(s.names, name)
+		s.rules = append(s.rules, exp)
+	}
+	s.index()
+	return nil
+}
+
+// 重新给所有规则的关键词编号，相同规范化方式下相同的关键词使用同一个编号
+func (s *RuleSet) index() {
+	s.groups = s.groups[:0]
+	s.keywords = 0
+	groupOf := make(map[Fold]int)
+	keywordIds := make(map[Fold]map[string]int32)
+	for i, rule := range s.rules {
+		g, ok := groupOf[rule.fold]
+		if !ok {
+			g = len(s.groups)
+			groupOf[rule.fold] = g
+			s.groups = append(s.groups, ruleGroup{fold: rule.fold})
+			keywordIds[rule.fold] = make(map[string]int32)
+		}
+		group := &s.groups[g]
+		ids := make([]int32, len(rule.program.keywords))
+		for j, keyword := range rule.program.keywords {
+			id, ok := keywordIds[rule.fold][keyword]
+			if !ok {
+				id = int32(s.keywords)
+				keywordIds[rule.fold][keyword] = id
+				s.keywords++
+			}
+			ids[j] = id
+		}
+		group.rules = append(group.rules, i)
+		group.ids = append(group.ids, ids)
+	}
+}
+
+// 返回所有规则的名字，顺序就是匹配结果中的顺序
+func (s *RuleSet) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.names...)
+}
+
+// 备忘录不超过这个大小时，匹配单条文本的备忘录分配在栈上
+const smallMemoSize = 256
+
+// 匹配一条文本，res[j]是第j条规则的匹配结果；除了返回的结果，规则的关键词不多时不分配内存
+func (s *RuleSet) Match(text string) []bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]bool, len(s.rules))
+	var small [smallMemoSize]uint8
+	var memo []uint8
+	if s.keywords > smallMemoSize {
+		memo = make([]uint8, s.keywords)
+	} else {
+		memo = small[:s.keywords]
+	}
+	buf := foldPool.Get().(*foldBuffer)
+	s.matchLine(text, res, memo, buf)
+	buf.release()
+	return res
+}
+
+// 批量匹配，res[i][j]是texts[i]跟第j条规则的匹配结果
+func (s *RuleSet) MatchBatch(texts []string) [][]bool {
+	return s.MatchBatchParallel(texts, 1)
+}
+
+/*
+ * 并发批量匹配，结果跟MatchBatch相同
+ * @Param concurrency: 并发的goroutine数，<=0时使用GOMAXPROCS
+ */
+func (s *RuleSet) MatchBatchParallel(texts []string, concurrency int) [][]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := len(s.rules)
+	flat := make([]bool, len(texts)*n)
+	res := make([][]bool, len(texts))
+	for i := range res {
+		res[i] = flat[i*n : (i+1)*n : (i+1)*n]
+	}
+	parallel(len(texts), concurrency, func(start, end int) {
+		s.matchBatch(texts[start:end], res[start:end])
+	})
+	return res
+}
+
+// 调用方需要持有读锁
+func (s *RuleSet) matchBatch(texts []string, res [][]bool) {
+	memo := make([]uint8, s.keywords)
+	buf := foldPool.Get().(*foldBuffer)
+	for i, text := range texts {
+		for j := range memo {
+			memo[j] = memoUnknown
+		}
+		s.matchLine(text, res[i], memo, buf)
+	}
+	buf.release()
+}
+
+// 一条文本跟所有规则匹配，memo需要是全部未查找的状态；调用方需要持有读锁
+func (s *RuleSet) matchLine(text string, res []bool, memo []uint8, buf *foldBuffer) {
+	for g := range s.groups {
+		group := &s.groups[g]
+		folded := text
+		if group.fold != 0 {
+			folded = buf.fold(text, group.fold)
+		}
+		for k, r := range group.rules {
+			res[r] = s.rules[r].program.matchMemo(folded, group.ids[k], memo)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package logexp
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// NewCache的size<=0时缓存的表达式个数
+const defaultCacheSize = 1024
+
+// 缓存的命中情况
+type CacheStats struct {
+	Hits     uint64 `json:"hits"`     // 命中的次数
+	Misses   uint64 `json:"misses"`   // 没有命中、重新编译的次数
+	Len      int    `json:"len"`      // 当前缓存的表达式个数
+	Capacity int    `json:"capacity"` // 最多缓存的表达式个数
+}
+
+/*
+ * 编译结果的LRU缓存，表达式文本和编译选项都相同时返回同一个*LogExp
+ * 编译失败的结果不缓存；Registry、Synonyms按引用区分，Registry修改了定义之后自动重新编译，Synonyms修改了内容之后需要调用Purge
+ * 设置了TimeOptions.Now的选项无法判断是否相同，这样的编译不经过缓存
+ * Cache可以被多个goroutine并发使用
+ */
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	lru      *list.List // 最近使用的在前面
+	items    map[cacheKey]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type cacheKey struct {
+	exp  string
+	opts string // 编译选项的文本形式
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	exp  *LogExp
+	refs cacheRefs
+}
+
+/*
+ * 缓存键中按地址区分的选项
+ * 缓存项持有它们的引用，保证缓存项存在期间这些地址不会被回收后分配给别的对象，从而命中过期的编译结果
+ */
+type cacheRefs struct {
+	location *time.Location
+	registry *Registry
+	synonyms Synonyms
+}
+
+/*
+ * @Param size: 最多缓存的表达式个数，超出时淘汰最久没有使用的，<=0时使用defaultCacheSize
+ */
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	return &Cache{
+		capacity: size,
+		lru:      list.New(),
+		items:    make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *Cache) Compile(exp string) (*LogExp, *CstError) {
+	return c.CompileWithOptions(exp, CompileOptions{})
+}
+
+// 跟CompileWithOptions相同，命中缓存时直接返回之前编译的结果
+func (c *Cache) CompileWithOptions(exp string, opts CompileOptions) (*LogExp, *CstError) {
+	if opts.Time.Now != nil {
+		c.mu.Lock()
+		c.misses++
+		c.mu.Unlock()
+		return CompileWithOptions(exp, opts)
+	}
+	key := cacheKey{exp: exp, opts: optionsKey(opts)}
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.hits++
+		c.mu.Unlock()
+		return elem.Value.(*cacheEntry).exp, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// 编译时不持有锁，并发编译同一个表达式时以先放入缓存的为准
+	compiled, cerr := CompileWithOptions(exp, opts)
+	if cerr != nil {
+		return nil, cerr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*cacheEntry).exp, nil
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{
+		key: key,
+		exp: compiled,
+		refs: cacheRefs{
+			location: opts.Time.Location,
+			registry: opts.Registry,
+			synonyms: opts.Synonyms,
+		},
+	})
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+	return compiled, nil
+}
+
+// 编译选项的文本形式，引用类型的选项按地址区分，Registry还带上修改的次数
+func optionsKey(opts CompileOptions) string {
+	var gen uint64
+	if opts.Registry != nil {
+		gen = opts.Registry.generation()
+	}
+	return fmt.Sprintf("%v|%v|%v|%v|%v|%v|%v|%q|%q|%p|%p@%v|%p",
+		opts.MaxLength, opts.MaxDepth, opts.MaxKeywords, opts.MaxNodes,
+		opts.Syntax, opts.Fold, opts.Pinyin,
+		opts.Time.Layouts, opts.Time.Field, opts.Time.Location,
+		opts.Registry, gen, opts.Synonyms)
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Len:      c.lru.Len(),
+		Capacity: c.capacity,
+	}
+}
+
+// 清空缓存，命中情况的统计不受影响
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[cacheKey]*list.Element)
+}
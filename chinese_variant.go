@@ -0,0 +1,102 @@
+package logexp
+
+/*
+ * 繁体字到简体字的对照表，每两个字符为一组：繁体在前，简体在后
+ * 多个繁体字可能对应同一个简体字（如“發”、“髮”都对应“发”），所以只做繁体到简体的单向折叠
+ */
+const t2sPairs = "" +
+	"萬万與与醜丑專专業业叢丛東东絲丝丟丢兩两嚴严喪丧個个豐丰臨临為为爲为麗丽舉举麼么義义烏乌樂乐喬乔" +
+	"習习鄉乡書书買买亂乱爭争於于虧亏雲云亞亚產产畝亩親亲褻亵億亿僅仅從从侖仑倉仓儀仪們们價价眾众衆众" +
+	"優优夥伙會会傴伛傘伞偉伟傳传傷伤倀伥倫伦傖伧偽伪僞伪佇伫體体餘余傭佣僉佥俠侠侶侣僥侥偵侦側侧僑侨" +
+	"儈侩儕侪儂侬俁俣儔俦儼俨倆俩儷俪儉俭債债傾倾僂偻僨偾償偿儻傥儐傧儲储儺傩兒儿兌兑兗兖黨党蘭兰關关" +
+	"興兴茲兹養养獸兽內内岡冈冊册寫写軍军農农馮冯衝冲決决況况凍冻淨净淒凄涼凉淩凌減减湊凑凜凛幾几鳳凤" +
+	"憑凭凱凯擊击鑿凿芻刍劃划劉刘則则剛刚創创刪删別别劊刽劌刿剴剀劑剂剮剐劍剑剝剥劇剧勸劝辦办務务勱劢" +
+	"動动勵励勁劲勞劳勢势勳勋勝胜區区醫医華华協协單单賣卖衛卫卻却厲厉厭厌參参變变嚇吓嗎吗嘆叹嚮向團团" +
+	"園园圍围圖图圓圆聖圣場场壞坏塊块堅坚報报塗涂墳坟墜坠壓压壩坝壇坛壘垒壯壮聲声壺壶處处備备復复複复" +
+	"夠够頭头夾夹奪夺奮奋獎奖婦妇媽妈婁娄嬰婴孫孙學学寧宁寶宝實实寵宠審审寬宽對对尋寻導导將将爾尔塵尘" +
+	"嘗尝屆届屍尸層层屬属島岛峽峡崗岗嶺岭嶽岳幣币師师帥帅帶带幫帮幹干廣广莊庄慶庆廬庐廳厅廠厂廚厨廟庙" +
+	"廢废開开異异棄弃張张彈弹強强歸归當当錄录彙汇匯汇彥彦後后徑径徵征憶忆憲宪懇恳懲惩戀恋戲戏戰战戶户" +
+	"愛爱憂忧懷怀態态憐怜懼惧懶懒應应惡恶悶闷慣惯慘惨憤愤懸悬總总擁拥擇择擔担據据擴扩擠挤擬拟擾扰攝摄" +
+	"搶抢撲扑掃扫掛挂換换揮挥損损搖摇攜携撐撑撫抚擲掷擺摆攤摊攔拦搗捣摟搂撥拨撈捞擰拧攪搅採采揚扬撿捡" +
+	"擋挡執执挾挟捨舍掙挣掄抡敵敌數数斂敛斃毙齋斋斬斩斷断時时晉晋晝昼暈晕暉晖暢畅曉晓曆历歷历曬晒暫暂" +
+	"朧胧術术條条極极構构槍枪樣样標标樓楼樹树橋桥機机檢检櫃柜權权欄栏棧栈棟栋楊杨楓枫榮荣槓杠樁桩樞枢" +
+	"檯台臺台颱台櫻樱欖榄欽钦歡欢歐欧歲岁殘残殺杀殼壳毀毁氣气沒没溝沟準准滅灭滬沪滯滞滲渗滿满漁渔漢汉" +
+	"潔洁潛潜澤泽濃浓濤涛瀏浏灣湾灑洒灘滩淚泪淺浅測测湯汤溫温濕湿溼湿滾滚漿浆潤润澀涩濱滨無无煉炼煩烦" +
+	"熱热燈灯燦灿爛烂爺爷牆墙牽牵犧牺狀状猶犹獄狱獨独獲获穫获獵猎獻献狹狭獅狮瑪玛環环現现璽玺畫画畢毕" +
+	"疊叠療疗瘋疯瘡疮癢痒癡痴發发髮发皚皑盜盗盞盏盡尽儘尽監监盤盘盧卢睜睁矯矫礎础礙碍碩硕確确碼码磚砖" +
+	"禮礼禍祸禪禅離离種种稱称穩稳積积窮穷竊窃竅窍競竞筆笔節节範范築筑簡简簽签籃篮籌筹類类糧粮糾纠罰罚" +
+	"罷罢羅罗聞闻聯联聰聪聳耸職职聽听肅肃脅胁脈脉腦脑腫肿膚肤膠胶臉脸臟脏髒脏舊旧艙舱艦舰艱艰藝艺葉叶" +
+	"蒼苍蓋盖蓮莲蔣蒋蔥葱蔔卜薦荐薩萨藍蓝蘇苏蘋苹蘿萝虛虚號号蟲虫蠶蚕蠻蛮補补裝装製制襯衬襲袭觸触遊游" +
+	"運运過过達达違违遙遥遞递遠远適适遲迟遷迁選选遺遗遼辽邊边還还郵邮鄰邻醬酱釀酿釋释裡里裏里陸陆陳陈" +
+	"陣阵隊队階阶際际隻只雙双雛雏雞鸡鷄鸡難难電电霧雾靈灵靜静韻韵響响飛飞鬆松鬥斗鬧闹鬱郁魯鲁鹽盐點点" +
+	"齊齐迴回這这逕径週周進进辭辞趕赶趙赵趨趋跡迹踐践蹤踪躍跃軀躯豈岂豎竖貓猫鄧邓鄭郑陝陕陰阴陽阳隨随" +
+	"險险隱隐雖虽雜杂營营煙烟燒烧爐炉來来國国經经級级係系繫系員员認认計计間间門门連连錯错誤误線线庫库" +
+	"資资訊讯統统帳帐賬账請请啟启啓启閉闭緒绪調调敗败證证驗验麵面麥麦黃黄龜龟龍龙龐庞龔龚齒齿齡龄韋韦" +
+	"韓韩韌韧風风颳刮飄飘颯飒飯饭飲饮飽饱飼饲餅饼餓饿館馆餵喂饑饥飢饥飾饰餃饺饒饶饋馈饞馋頁页頂顶項项" +
+	"順顺須须鬚须預预領领頻频題题額额顏颜顯显願愿顧顾頓顿頒颁頌颂頑顽頗颇頸颈頰颊頹颓顆颗顛颠顫颤顱颅" +
+	"鳥鸟鳴鸣鴨鸭鵝鹅鷹鹰鶴鹤鴿鸽鶯莺鵬鹏鷗鸥鴻鸿鵲鹊魚鱼鮮鲜鯨鲸鯉鲤鰻鳗鱷鳄鯊鲨鱸鲈鮑鲍鯽鲫馬马駕驾" +
+	"駛驶驅驱騎骑騙骗驚惊驕骄驟骤騰腾驛驿駐驻駁驳騷骚驢驴駝驼馴驯駒驹驍骁駿骏騁骋車车軌轨軟软轉转輪轮" +
+	"輸输載载較较輕轻輔辅輛辆輯辑輩辈轎轿轟轰轄辖輿舆轍辙軸轴軒轩軋轧輻辐輾辗見见規规視视覺觉覽览觀观" +
+	"覓觅貝贝負负財财貢贡貧贫貨货販贩貪贪責责貫贯貴贵費费貿贸賀贺質质購购賽赛贊赞讚赞贈赠賞赏賠赔賦赋" +
+	"賴赖賺赚賭赌贏赢贖赎賜赐賓宾賢贤貶贬貸贷貯贮貼贴賄贿賂赂賊贼賤贱賃赁賈贾贓赃閒闲閑闲閃闪閣阁閱阅" +
+	"闊阔闖闯闆板闡阐闢辟閘闸閥阀閩闽閨闺闕阙闌阑閻阎閡阂閏闰閔闵問问網网絡络紅红約约紀纪純纯紙纸納纳" +
+	"紛纷紡纺終终組组細细織织結结絕绝給给綁绑維维綜综綠绿緊紧續续練练編编緣缘緩缓縮缩績绩繼继纖纤纜缆" +
+	"繞绕繩绳縣县繪绘紋纹紗纱紐纽絨绒綢绸縫缝繃绷繳缴縱纵緯纬締缔緝缉縛缚緻致纏缠纔才紹绍紳绅綱纲綿绵" +
+	"緬缅縷缕繡绣纓缨緋绯綺绮綻绽緞缎鐘钟鍾钟錢钱鋼钢鐵铁銀银銷销鎖锁鏈链鏡镜鍵键針针釘钉鈕钮鈔钞鉛铅" +
+	"鈴铃銅铜鋁铝鋒锋鋪铺鋸锯鍋锅鍛锻鎮镇鏟铲鑰钥鑽钻錶表銳锐錦锦鍊炼錘锤鏽锈鑄铸鑑鉴鑒鉴鈍钝釣钓鈣钙" +
+	"鈉钠鉀钾鋅锌錳锰鎳镍鈷钴鉻铬鎢钨鉑铂鈾铀錫锡銲焊語语說说話话讀读識识詞词試试詳详課课談谈論论設设" +
+	"許许記记訂订訪访評评議议護护譯译讓让訴诉診诊該该誠诚謝谢謎谜講讲謠谣諾诺諸诸謀谋諒谅討讨訓训託托" +
+	"訝讶訟讼詐诈詢询詩诗詮诠誇夸誌志誰谁諮咨諷讽謊谎謹谨譜谱譽誉豬猪猻狲啞哑嗚呜嘔呕嘩哗噴喷囑嘱喚唤" +
+	"唄呗喲哟嘮唠嚨咙嘍喽噸吨噹当囂嚣蘊蕴蕭萧薑姜藥药蘆芦蔭荫莖茎莢荚萊莱葦苇葷荤蓽荜薺荠藹蔼蘚藓虜虏" +
+	"蝦虾蝕蚀螞蚂蟻蚁蠟蜡蠅蝇蟬蝉衊蔑褲裤襪袜觴觞訃讣詛诅誘诱誣诬誦诵諜谍諦谛謁谒謗谤譏讥譴谴讒谗貞贞" +
+	"貳贰賑赈贍赡趲趱躉趸躊踌軻轲軼轶輒辄輓挽輜辎轂毂轅辕辮辫辯辩迺乃逬迸遜逊邁迈邇迩郟郏鄖郧鄺邝醞酝" +
+	"釁衅釐厘鈞钧鉤钩鉅钜鉗钳銜衔銬铐鋤锄鋌铤鋏铗錨锚鍍镀鎊镑鎔熔鏢镖鏤镂鐮镰鐺铛鑠铄鑲镶鑼锣鑾銮長长" +
+	"悵怅脹胀漲涨檔档潑泼隸隶靂雳靄霭韁缰韜韬頃顷頦颏頷颔顎颚顓颛顥颢颶飓颼飕飆飙飩饨餌饵餑饽餚肴餛馄" +
+	"餞饯餡馅餿馊饅馒饃馍饈馐饗飨馳驰駭骇駱骆駢骈騖骛騫骞騮骝騶驺驀蓦驃骠驄骢驊骅驥骥驪骊骯肮髏髅髖髋" +
+	"鬍胡鬢鬓鬩阋鬮阄魎魉魘魇鯰鲶鰓鳃鰭鳍鱗鳞鳶鸢鴉鸦鴕鸵鴛鸳鴦鸯鵑鹃鵡鹉鶇鸫鶩鹜鷓鹧鷲鹫鷺鹭鸚鹦鸞鸾" +
+	"麩麸黴霉黿鼋鼴鼹齣出齪龊齟龃齦龈齬龉齷龌龕龛盃杯碁棋祿禄禱祷稅税穌稣窩窝窪洼窯窑竄窜竇窦筍笋箋笺" +
+	"箏筝篤笃篩筛篳筚簀箦簍篓簞箪簫箫籜箨籟籁籠笼籤签籬篱粵粤糞粪糰团紂纣紉纫紓纾紕纰紮扎紱绂紲绁紺绀" +
+	"紼绋絀绌絃弦絎绗絛绦絞绞絢绚絳绛絹绢綃绡綆绠綏绥綑捆綞缍綬绶綴缀綵彩綸纶緄绲緇缁緙缂緡缗緦缌緱缑" +
+	"緲缈緹缇縉缙縊缢縑缣縝缜縞缟縟缛縭缡縵缦縶絷縹缥繅缫繆缪繈襁繒缯繕缮繚缭繢缋繭茧繯缳繰缲繹绎纈缬" +
+	"纊纩纍累纘缵罈坛罌罂罵骂羈羁羋芈羥羟羨羡翹翘翺翱耬耧聹聍聶聂脛胫脣唇脩修脫脱腎肾腖胨腡脶腸肠膃腽" +
+	"膩腻膽胆膾脍膿脓臍脐臏膑臘腊臚胪臠脔臢臜舖铺艤舣艷艳苧苎荊荆莧苋菴庵萇苌萵莴葒荭葤荮蒔莳蓀荪蓯苁" +
+	"蔞蒌蔦茑蕁荨蕎荞蕓芸蕕莸蕘荛薈荟薊蓟薌芗薔蔷薘荙薟莶薰熏藎荩藪薮藶苈藺蔺蘄蕲蘢茏蘺蓠虯虬蛺蛱蛻蜕" +
+	"蜆蚬蝨虱蝸蜗螄蛳螢萤螻蝼蟄蛰蟈蝈蟎螨蟣虮蟯蛲蠆虿蠍蝎蠐蛴蠑蝾蠣蛎衚胡衹只袞衮裊袅褳裢褸褛襖袄襝裣" +
+	"襠裆襤褴襬摆覘觇覡觋覦觎覬觊覯觏覲觐覷觑觶觯訌讧訐讦訕讪訖讫訛讹訥讷訶诃詁诂詆诋詎讵詒诒詔诏詘诎" +
+	"詡诩詣诣詫诧詬诟詭诡詼诙誄诔誅诛誑诳誒诶誚诮誥诰誨诲誶谇諂谄諄谆諉诿諍诤諏诹諑诼諗谂諛谀諞谝諢诨" +
+	"諤谔諧谐諫谏諭谕諳谙諶谌諺谚諼谖謂谓謅诌謄誊謐谧謔谑謖谡謙谦謚谥謨谟謫谪謬谬謳讴譁哗譎谲譖谮譙谯" +
+	"譚谭譫谵譾谫讕谰讖谶讜谠讞谳谘咨豔艳豶豮賅赅賒赊賕赇賙赒賚赉賡赓賧赕賵赗賻赙贄贽贅赘贇赟贐赆贗赝" +
+	"贛赣赬赪跼局踴踊蹌跄蹕跸蹣蹒蹺跷躂跶躑踯躒跞躓踬躚跹躡蹑躥蹿躦躜軔轫軛轭軤轷軫轸軲轱軹轵軺轺輅辂" +
+	"輇辁輊轾輟辍輥辊輦辇輬辌輳辏輷轰轀辒轆辘轔辚轡辔轢轹轤轳邏逻邐逦鄆郓鄒邹鄔邬鄲郸鄴邺鄶郐酈郦醃腌" +
+	"醖酝醱酦釃酾釅酽鈀钯鈁钫鈄钭鈅钥鈈钚鈑钣鈐钤鈦钛鈸钹鈹铍鈺钰鈿钿鉈铊鉋刨鉍铋鉚铆鉞钺鉬钼鉸铰鉺铒" +
+	"鉿铪銃铳銓铨銖铢銘铭銚铫銠铑銣铷銥铱銦铟銨铵銩铥銪铕銫铯銱铞銹锈銻锑銼锉鋇钡鋃锒鋝锊鋟锓鋣铘鋥锃" +
+	"鋦锔鋨锇鋩铓鋮铖鋯锆鋰锂鋱铽鋶锍錁锞錆锖錈锩錐锥錒锕錕锟錙锱錚铮錛锛錟锬錠锭錡锜錮锢錸铼鍀锝鍁锨" +
+	"鍆钔鍇锴鍈锳鍔锷鍘铡鍥锲鍬锹鍰锾鍶锶鎂镁鎄锿鎌镰鎘镉鎚锤鎛镈鎦镏鎧铠鎩铩鎪锼鎬镐鎰镒鎵镓鏃镞鏇镟" +
+	"鏌镆鏍镙鏑镝鏗铿鏘锵鏜镗鏝镘鏞镛鏨錾鏵铧鏷镤鏹镪鐃铙鐋铴鐐镣鐒铹鐓镦鐔镡鐙镫鐠镨鐫镌鐲镯鐳镭鐸铎" +
+	"鐿镱鑊镬鑌镔鑔镲鑣镳鑭镧鑷镊鑹镩閂闩閆闫閈闬閌闶閎闳閤合閫阃閬阆閭闾閶阊閹阉閼阏閽阍閾阈閿阌闃阒" +
+	"闈闱闋阕闐阗闔阖闥闼闞阚隉陧隕陨隴陇雋隽霽霁靚靓靦腼鞏巩鞽鞒韃鞑韆千韉鞯韙韪韞韫頇顸頊顼頎颀頏颃" +
+	"頜颌頡颉頤颐頮颒頲颋顒颙顙颡顢颟顣颦顬颥顰颦顳颞颮飑颸飔颺飏颻飖飀飗飣饤飪饪飫饫飭饬飴饴餄饸餉饷" +
+	"餎饹餏饻餒馁餕馂餖饾餜馃餱糇餳饧餷馇餺馎餼饩餾馏饁馌饉馑饌馔饜餍饝馍饢馕馭驭馱驮馹驲駑驽駔驵駘骀" +
+	"駟驷駙驸駰骃駸骎騂骍騅骓騌鬃騍骒騏骐騭骘騾骡驁骜驂骖驌骕驏骣驤骧驦骦驫骉髕髌鬨哄魷鱿魴鲂鮁鲅鮃鲆" +
+	"鮊鲌鮋鲉鮍鲏鮎鲇鮐鲐鮒鲋鮓鲊鮚鲒鮜鲘鮝鲞鮞鲕鮦鲖鮪鲔鮫鲛鮭鲑鯀鲧鯁鲠鯇鲩鯔鲻鯖鲭鯗鲞鯛鲷鯝鲴鯡鲱" +
+	"鯢鲵鯤鲲鯧鲳鯪鲮鯫鲰鯴鲺鯷鳀鯿鳊鰁鳈鰂鲗鰈鲽鰉鳇鰍鳅鰐鳄鰒鳆鰜鳒鰟鳑鰠鳋鰣鲥鰥鳏鰨鳎鰩鳐鰱鲢鰲鳌" +
+	"鰳鳓鰷鲦鰹鲣鰺鲹鰼鳛鰾鳔鱈鳕鱉鳖鱒鳟鱔鳝鱖鳜鱘鲟鱝鲼鱟鲎鱠鲙鱣鳣鱤鳡鱧鳢鱨鲿鱭鲚鱯鳠鱺鲡鳩鸠鳬凫" +
+	"鳲鸤鴆鸩鴇鸨鴝鸲鴟鸱鴣鸪鴯鸸鴰鸹鴴鸻鵂鸺鵃鸼鵐鹀鵓鹁鵒鹆鵜鹈鵠鹄鵪鹌鵯鹎鵰雕鵷鹓鵾鹍鶉鹑鶓鹋鶘鹕" +
+	"鶚鹗鶡鹖鶥鹛鶬鸧鶲鹟鶹鹠鶺鹡鶻鹘鶼鹣鶿鹚鷀鹚鷂鹞鷊鹝鷖鹥鷙鸷鷚鹨鷥鸶鷦鹪鷯鹩鷳鹇鷸鹬鷽鸴鸇鹯鸌鹱" +
+	"鸏鹲鸕鸬鸘鹴鸛鹳鸝鹂鹵卤鹹咸鹺鹾鹼碱麯曲黌黉黲黪黷黩黽黾鼉鼍鼕冬齎赍齏齑齔龀齙龅齜龇齠龆齲龋齶腭"
+
+var t2sTable = func() map[rune]rune {
+	pairs := []rune(t2sPairs)
+	res := make(map[rune]rune, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		res[pairs[i]] = pairs[i+1]
+	}
+	return res
+}()
+
+func t2sRune(r rune) rune {
+	if s, ok := t2sTable[r]; ok {
+		return s
+	}
+	return r
+}
@@ -0,0 +1,341 @@
+package logexp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * 比较表达式：从文本中取出键Key对应的数值，跟上下界比较，有一个数值在范围内即算匹配
+ * 数值来自key=value、key:value形式的词，或者JSON中的"key": value字段；数值后面的单位（例如ms）被忽略
+ */
+type ExpressionCompare struct {
+	Type         ExpressionType `json:"type"`
+	IsNegative   bool           `json:"is_negative"`   // 是否取非
+	Key          string         `json:"key"`           // 键
+	Min          *float64       `json:"min"`           // 下界，nil表示没有下界
+	Max          *float64       `json:"max"`           // 上界，nil表示没有上界
+	ExclusiveMin bool           `json:"exclusive_min"` // 是否不包含下界
+	ExclusiveMax bool           `json:"exclusive_max"` // 是否不包含上界
+}
+
+func (e *ExpressionCompare) GetIsNegative() bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionCompare) GetType() ExpressionType {
+	return e.Type
+}
+
+func (e *ExpressionCompare) GetExps() []IExpression {
+	return nil
+}
+
+func (e *ExpressionCompare) Match(text string) bool {
+	res := false
+	for i := 0; i < len(text); {
+		value, offset, next := findKeyValue(text, i, e.Key)
+		if offset < 0 {
+			break
+		}
+		if e.inRange(value) {
+			res = true
+			break
+		}
+		i = next
+	}
+	if e.IsNegative {
+		res = !res
+	}
+	return res
+}
+
+func (e *ExpressionCompare) inRange(value float64) bool {
+	if e.Min != nil && (value < *e.Min || e.ExclusiveMin && value == *e.Min) {
+		return false
+	}
+	if e.Max != nil && (value > *e.Max || e.ExclusiveMax && value == *e.Max) {
+		return false
+	}
+	return true
+}
+
+func (e *ExpressionCompare) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionCompare) String() string {
+	var s string
+	switch {
+	case e.Min != nil && e.Max == nil:
+		s = e.Key + compareOp('>', e.ExclusiveMin) + formatNumber(*e.Min)
+	case e.Min == nil && e.Max != nil:
+		s = e.Key + compareOp('<', e.ExclusiveMax) + formatNumber(*e.Max)
+	default:
+		left, right := "[", "]"
+		if e.ExclusiveMin {
+			left = "{"
+		}
+		if e.ExclusiveMax {
+			right = "}"
+		}
+		s = e.Key + ":" + left + formatBound(e.Min) + " TO " + formatBound(e.Max) + right
+	}
+	if e.IsNegative {
+		return "!" + s
+	}
+	return s
+}
+
+// 说明取到的数值
+func (e *ExpressionCompare) explain(text string) string {
+	values := make([]string, 0)
+	for i := 0; i < len(text); {
+		value, offset, next := findKeyValue(text, i, e.Key)
+		if offset < 0 {
+			break
+		}
+		if e.inRange(value) {
+			return fmt.Sprintf("%v=%v at offset %v is in range", e.Key, formatNumber(value), offset)
+		}
+		values = append(values, formatNumber(value))
+		i = next
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("no value for %v", e.Key)
+	}
+	return fmt.Sprintf("%v=%v out of range", e.Key, strings.Join(values, ","))
+}
+
+func compareOp(op byte, exclusive bool) string {
+	if exclusive {
+		return string(op)
+	}
+	return string(op) + "="
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatBound(bound *float64) string {
+	if bound == nil {
+		return "*"
+	}
+	return formatNumber(*bound)
+}
+
+/*
+ * 从位置start开始查找键key对应的数值
+ * 返回数值、键在文本中的位置和继续查找的位置，找不到时位置返回-1
+ */
+func findKeyValue(text string, start int, key string) (float64, int, int) {
+	for {
+		offset, j := findKey(text, start, key)
+		if offset < 0 {
+			return 0, -1, len(text)
+		}
+		start = offset + len(key)
+		if j < len(text) && text[j] == '"' {
+			j++
+		}
+		if value, n := parseNumber(text[j:]); n > 0 {
+			return value, offset, j + n
+		}
+	}
+}
+
+/*
+ * 从位置start开始查找键key，键必须是一个完整的词（JSON中可以带引号），后面跟着'='或者':'
+ * 返回键在文本中的位置和值开始的位置，找不到时位置返回-1
+ */
+func findKey(text string, start int, key string) (int, int) {
+	for start < len(text) {
+		i := strings.Index(text[start:], key)
+		if i < 0 {
+			return -1, -1
+		}
+		offset := start + i
+		start = offset + len(key)
+		if offset > 0 {
+			if r, _ := utf8.DecodeLastRuneInString(text[:offset]); isKeyRune(r) {
+				continue
+			}
+		}
+		j := start
+		if offset > 0 && text[offset-1] == '"' {
+			if j >= len(text) || text[j] != '"' {
+				continue
+			}
+			j++
+		}
+		j = skipBlank(text, j)
+		if j >= len(text) || (text[j] != '=' && text[j] != ':') {
+			continue
+		}
+		return offset, skipBlank(text, j+1)
+	}
+	return -1, -1
+}
+
+// 解析文本开头的数值，返回数值和数值的长度，不是数值时长度为0
+func parseNumber(s string) (float64, int) {
+	n := 0
+	if n < len(s) && (s[n] == '-' || s[n] == '+') {
+		n++
+	}
+	digits := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+		digits++
+	}
+	if n+1 < len(s) && s[n] == '.' && s[n+1] >= '0' && s[n+1] <= '9' {
+		n++
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, 0
+	}
+	value, err := strconv.ParseFloat(s[:n], 64)
+	if err != nil {
+		return 0, 0
+	}
+	return value, n
+}
+
+func skipBlank(text string, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// 可以出现在键里的字符
+func isKeyRune(r rune) bool {
+	return r == '_' || r == '.' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !isKeyRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * 解析比较表达式：key>N、key>=N、key<N、key<=N，或者区间key:[A TO B]
+ * 区间用'['、']'表示包含边界，用'{'、'}'表示不包含边界，'*'表示没有边界
+ * 不是比较表达式时返回nil；是区间的写法但是不合法时返回错误
+ */
+func (p *parser) parseCompare(exp string, isNegative bool) (IExpression, *CstError) {
+	cmp := ExpressionCompare{
+		Type:       ExpressionType_Compare,
+		IsNegative: isNegative,
+	}
+	if key, rng, ok := splitRange(exp); ok {
+		cmp.Key = key
+		lower, upper, ok := parseRangeBounds(rng)
+		if !isKey(cmp.Key) || !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid range expression: %v", exp)
+		}
+		if cmp.Min, ok = parseBound(lower); !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid range expression: %v", exp)
+		}
+		if cmp.Max, ok = parseBound(upper); !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid range expression: %v", exp)
+		}
+		cmp.ExclusiveMin = rng[0] == '{'
+		cmp.ExclusiveMax = rng[len(rng)-1] == '}'
+		return p.foldKey(&cmp, exp)
+	}
+	key, op, rest, ok := splitCompareOp(exp)
+	if !ok {
+		return nil, nil
+	}
+	cmp.Key = key
+	value, n := parseNumber(rest)
+	if !isKey(cmp.Key) || n == 0 || n != len(rest) {
+		// 例如a->b，当作普通的关键词
+		return nil, nil
+	}
+	switch op {
+	case ">":
+		cmp.Min, cmp.ExclusiveMin = &value, true
+	case ">=":
+		cmp.Min = &value
+	case "<":
+		cmp.Max, cmp.ExclusiveMax = &value, true
+	case "<=":
+		cmp.Max = &value
+	}
+	return p.foldKey(&cmp, exp)
+}
+
+// 写法按原样解析，只有键跟匹配时的文本一样做规范化，例如Fold_Case下区间里的TO不会被改成小写
+func (p *parser) foldKey(cmp *ExpressionCompare, exp string) (IExpression, *CstError) {
+	cmp.Key = p.foldKeyword(cmp.Key)
+	if !isKey(cmp.Key) {
+		return nil, newCstError(ErrCodeInvalidExpression, "invalid key after folding: %v", exp)
+	}
+	return cmp, nil
+}
+
+func parseBound(s string) (*float64, bool) {
+	if s == "*" {
+		return nil, true
+	}
+	value, n := parseNumber(s)
+	if n == 0 || n != len(s) {
+		return nil, false
+	}
+	return &value, true
+}
+
+// 拆分区间的写法key:[...]，返回键和区间部分
+func splitRange(exp string) (string, string, bool) {
+	i := strings.Index(exp, ":")
+	if i > 0 && i+1 < len(exp) && (exp[i+1] == '[' || exp[i+1] == '{') {
+		return exp[:i], exp[i+1:], true
+	}
+	return "", "", false
+}
+
+// 解析区间[A TO B]的上下界，返回上下界的文本
+func parseRangeBounds(rng string) (string, string, bool) {
+	if len(rng) < 2 || (rng[len(rng)-1] != ']' && rng[len(rng)-1] != '}') {
+		return "", "", false
+	}
+	parts := strings.Fields(rng[1 : len(rng)-1])
+	if len(parts) != 3 || parts[1] != "TO" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// 拆分比较的写法key>N，返回键、运算符和运算符之后的部分
+func splitCompareOp(exp string) (string, string, string, bool) {
+	i := strings.IndexAny(exp, "<>")
+	if i <= 0 {
+		return "", "", "", false
+	}
+	op := exp[i : i+1]
+	rest := exp[i+1:]
+	if strings.HasPrefix(rest, "=") {
+		op += "="
+		rest = rest[1:]
+	}
+	return exp[:i], op, rest, true
+}
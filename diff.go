@@ -0,0 +1,227 @@
+package logexp
+
+import (
+	"sort"
+	"strings"
+)
+
+// 两个编译后的表达式之间的结构差异
+type ExpDiff struct {
+	AddedKeywords    []string `json:"added_keywords"`    // 新增的关键词
+	RemovedKeywords  []string `json:"removed_keywords"`  // 删除的关键词
+	FlippedNegations []string `json:"flipped_negations"` // 取非标记被翻转的表达式（新表达式中的规范形式）
+	Restructured     []string `json:"restructured"`      // 分组结构发生调整的表达式（新表达式中的规范形式）
+}
+
+func (d *ExpDiff) IsEmpty() bool {
+	return len(d.AddedKeywords) == 0 && len(d.RemovedKeywords) == 0 &&
+		len(d.FlippedNegations) == 0 && len(d.Restructured) == 0
+}
+
+/*
+ * 比较两个编译后的表达式，a为旧表达式，b为新表达式
+ * 比较前两棵树都会被规范化：子表达式按规范形式排序，所以子表达式的先后顺序不影响比较结果
+ * 结构调整和取非翻转只在两者共有的关键词上比较，新增或删除关键词本身不算作结构调整
+ */
+func Diff(a, b *LogExp) *ExpDiff {
+	diff := ExpDiff{
+		AddedKeywords:    make([]string, 0),
+		RemovedKeywords:  make([]string, 0),
+		FlippedNegations: make([]string, 0),
+		Restructured:     make([]string, 0),
+	}
+	nodeA := newDiffNode(a.expression)
+	nodeB := newDiffNode(b.expression)
+
+	// 关键词按出现次数比较
+	countA := map[string]int{}
+	countB := map[string]int{}
+	nodeA.countKeywords(countA)
+	nodeB.countKeywords(countB)
+	common := map[string]bool{}
+	for kw, n := range countA {
+		if n > countB[kw] {
+			diff.RemovedKeywords = append(diff.RemovedKeywords, kw)
+		}
+		if countB[kw] > 0 {
+			common[kw] = true
+		}
+	}
+	for kw, n := range countB {
+		if n > countA[kw] {
+			diff.AddedKeywords = append(diff.AddedKeywords, kw)
+		}
+	}
+	sort.Strings(diff.AddedKeywords)
+	sort.Strings(diff.RemovedKeywords)
+
+	// 只保留共有的关键词，再比较结构
+	nodeA = nodeA.prune(common)
+	nodeB = nodeB.prune(common)
+	if nodeA == nil || nodeB == nil {
+		return &diff
+	}
+	fullA := map[string]bool{}
+	shapeA := map[string]bool{}
+	nodeA.collect(fullA, shapeA)
+	nodeB.findFlipped(fullA, &diff.FlippedNegations)
+	nodeB.findRestructured(shapeA, &diff.Restructured)
+	return &diff
+}
+
+// 用于比较的规范化节点
+type diffNode struct {
+	typ        ExpressionType
+	isNegative bool
+	keyword    string      // 叶子节点的关键词（不含取非标记）
+	children   []*diffNode // 按规范形式排序后的子节点
+	body       string      // 不含自身取非标记的规范形式
+	full       string      // 规范形式
+	shape      string      // 忽略所有取非标记的规范形式
+}
+
+func newDiffNode(exp IExpression) *diffNode {
+	node := diffNode{
+		typ:        exp.GetType(),
+		isNegative: exp.GetIsNegative(),
+	}
+	exps := exp.GetExps()
+	if len(exps) == 0 {
+		node.keyword = expressionString(exp)
+		if node.isNegative {
+			node.keyword = strings.TrimPrefix(node.keyword, "!")
+		}
+	} else {
+		node.children = make([]*diffNode, len(exps))
+		for i := range exps {
+			node.children[i] = newDiffNode(exps[i])
+		}
+	}
+	node.finish()
+	return &node
+}
+
+func (n *diffNode) isGroup() bool {
+	return len(n.children) > 0
+}
+
+// 对子节点排序，并计算规范形式
+func (n *diffNode) finish() {
+	if !n.isGroup() {
+		n.body = n.keyword
+		n.shape = n.keyword
+	} else {
+		sort.SliceStable(n.children, func(i, j int) bool {
+			return n.children[i].full < n.children[j].full
+		})
+		sep := "|"
+		if n.typ == ExpressionType_And {
+			sep = "&"
+		}
+		bodies := make([]string, len(n.children))
+		shapes := make([]string, len(n.children))
+		for i, child := range n.children {
+			bodies[i] = child.full
+			shapes[i] = child.shape
+			if child.isGroup() {
+				if !child.isNegative {
+					bodies[i] = "(" + bodies[i] + ")"
+				}
+				shapes[i] = "(" + shapes[i] + ")"
+			}
+		}
+		n.body = strings.Join(bodies, sep)
+		n.shape = strings.Join(shapes, sep)
+	}
+	n.full = n.withNegative(n.isNegative)
+}
+
+// 返回节点在指定取非标记下的规范形式
+func (n *diffNode) withNegative(isNegative bool) string {
+	if !isNegative {
+		return n.body
+	}
+	if n.isGroup() {
+		return "!(" + n.body + ")"
+	}
+	return "!" + n.body
+}
+
+func (n *diffNode) countKeywords(count map[string]int) {
+	if !n.isGroup() {
+		count[n.keyword]++
+	}
+	for _, child := range n.children {
+		child.countKeywords(count)
+	}
+}
+
+// 去掉关键词不在keep中的叶子节点，返回修剪并重新展开后的节点，节点被整个剪掉时返回nil
+func (n *diffNode) prune(keep map[string]bool) *diffNode {
+	if !n.isGroup() {
+		if keep[n.keyword] {
+			return n
+		}
+		return nil
+	}
+	children := make([]*diffNode, 0, len(n.children))
+	for _, child := range n.children {
+		child = child.prune(keep)
+		if child == nil {
+			continue
+		}
+		if child.isGroup() && child.typ == n.typ && !child.isNegative {
+			// 同类型的子表达式直接展开
+			children = append(children, child.children...)
+		} else {
+			children = append(children, child)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		// 只剩一个子节点，往上提
+		node := *children[0]
+		node.isNegative = node.isNegative != n.isNegative
+		node.full = node.withNegative(node.isNegative)
+		return &node
+	}
+	node := *n
+	node.children = children
+	node.finish()
+	return &node
+}
+
+func (n *diffNode) collect(full map[string]bool, shape map[string]bool) {
+	full[n.full] = true
+	shape[n.shape] = true
+	for _, child := range n.children {
+		child.collect(full, shape)
+	}
+}
+
+// 找出跟旧表达式相比只有取非标记不同的节点
+func (n *diffNode) findFlipped(fullA map[string]bool, res *[]string) {
+	if fullA[n.full] {
+		return
+	}
+	if fullA[n.withNegative(!n.isNegative)] {
+		*res = append(*res, n.full)
+		return
+	}
+	for _, child := range n.children {
+		child.findFlipped(fullA, res)
+	}
+}
+
+// 找出在旧表达式中不存在相同分组结构的组
+func (n *diffNode) findRestructured(shapeA map[string]bool, res *[]string) {
+	if !n.isGroup() || shapeA[n.shape] {
+		return
+	}
+	*res = append(*res, n.full)
+	for _, child := range n.children {
+		child.findRestructured(shapeA, res)
+	}
+}
@@ -0,0 +1,656 @@
+package logexp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * 段文件的格式，整数都是小端序：
+ *   文件头    magic[8] fold:u32 docs:u32 grams:u32 postings:u32
+ *   文档偏移  (docs+1)个u64，第i篇文档是文档数据中[offsets[i], offsets[i+1])的部分
+ *   文档数据  所有文档按顺序拼接，末尾补0对齐到4字节
+ *   三元组表  grams个{gram:u32 start:u32 count:u32}，按gram递增，倒排表是postings中[start, start+count)的部分
+ *   倒排表    postings个u32，段内的文档编号
+ */
+const (
+	segmentMagic      = "LOGEXP\x00\x01"
+	segmentHeaderSize = 24
+	segmentGramSize   = 12
+	segmentExt        = ".seg"
+	lockFileName      = "LOCK"
+)
+
+/*
+ * 持久化在目录中的三元组倒排索引，重启之后直接打开已有的索引，不需要重新建立
+ * 添加的文档先放在内存中，Flush把它们写成一个新的段文件；段文件只追加、不修改，通过mmap读取
+ * Merge把所有段合并成一个，减少查询时要访问的段；合并在写完新段之后才删除旧段，中途崩溃不会丢失或者重复文档
+ * 查询的方式跟Index相同：用倒排表选出候选文档，再用Match逐个验证
+ * DiskIndex可以被多个goroutine并发使用，但是同一个目录同时只能被一个DiskIndex打开，打开时用目录中的锁文件保证
+ */
+type DiskIndex struct {
+	writeMu  sync.Mutex   // 串行化Flush、Merge、Close
+	mu       sync.RWMutex // 保护segments、flushing、pending
+	dir      string
+	fold     Fold
+	lock     *os.File   // 目录的锁文件，关闭DiskIndex时释放
+	segments []*segment // 按文档顺序排列
+	segDocs  int        // 所有段的文档总数
+	flushing *Index     // 正在写入段文件的文档，排在所有段之后
+	pending  *Index     // 还没有写入段文件的文档，排在flushing之后
+	nextSeq  int        // 下一个段的序号
+}
+
+// 一个段文件，只读
+type segment struct {
+	path        string
+	first, last int // 段包含的Flush序号范围，合并出来的段包含多个序号
+	data        []byte
+	docs        int
+	grams       int
+	postings    int
+	docsAt      int // 文档数据的起始位置
+	gramsAt     int // 三元组表的起始位置
+	postingsAt  int // 倒排表的起始位置
+}
+
+/*
+ * 打开目录中的索引，目录不存在时创建
+ * 目录已经被另一个DiskIndex打开时返回ErrCodeIndexLocked
+ * @Param fold: 建立索引前对文档做的规范化，必须跟已有段文件的一致
+ */
+func OpenDiskIndex(dir string, fold Fold) (*DiskIndex, *CstError) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, newCstError(ErrCodeIndexIO, "create index directory: %v", err)
+	}
+	lock, err := lockFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return nil, newCstError(ErrCodeIndexLocked, "index directory %v is already opened by another DiskIndex: %v", dir, err)
+	}
+	d := &DiskIndex{
+		dir:      dir,
+		fold:     fold,
+		lock:     lock,
+		flushing: NewIndex(fold),
+		pending:  NewIndex(fold),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		d.close()
+		return nil, newCstError(ErrCodeIndexIO, "read index directory: %v", err)
+	}
+	type segmentName struct {
+		first, last int
+	}
+	names := make([]segmentName, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		// 写到一半的段文件
+		if strings.HasSuffix(name, segmentExt+".tmp") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		var first, last int
+		if n, _ := fmt.Sscanf(name, "%d-%d"+segmentExt, &first, &last); n != 2 || name != segmentFileName(first, last) {
+			continue
+		}
+		names = append(names, segmentName{first: first, last: last})
+	}
+	// 范围大的段在前，被合并过的旧段在合并出来的段之后，会被跳过
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].first != names[j].first {
+			return names[i].first < names[j].first
+		}
+		return names[i].last > names[j].last
+	})
+	for _, name := range names {
+		path := filepath.Join(dir, segmentFileName(name.first, name.last))
+		if len(d.segments) > 0 && name.last <= d.segments[len(d.segments)-1].last {
+			// 合并之后没有来得及删除的旧段
+			os.Remove(path)
+			continue
+		}
+		if len(d.segments) > 0 && name.first <= d.segments[len(d.segments)-1].last {
+			d.close()
+			return nil, newCstError(ErrCodeIndexFormat, "overlapping segment: %v", path)
+		}
+		seg, cerr := openSegment(path, name.first, name.last, fold)
+		if cerr != nil {
+			d.close()
+			return nil, cerr
+		}
+		d.segments = append(d.segments, seg)
+		d.segDocs += seg.docs
+		d.nextSeq = name.last + 1
+	}
+	return d, nil
+}
+
+func segmentFileName(first, last int) string {
+	return fmt.Sprintf("%08d-%08d%v", first, last, segmentExt)
+}
+
+// 添加一篇文档，返回文档编号，编号从0开始递增；文档在Flush之后才会写入磁盘
+func (d *DiskIndex) Add(doc string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.segDocs + d.flushing.Len() + d.pending.Add(doc)
+}
+
+/*
+ * 把内存中的文档写成一个新的段文件
+ * 写段文件期间可以继续查询和添加文档，正在写入的文档仍然能被查询到
+ */
+func (d *DiskIndex) Flush() *CstError {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	// 持有writeMu时nextSeq不会变化
+	d.mu.Lock()
+	flushing := d.pending
+	if flushing.Len() == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	d.flushing = flushing
+	d.pending = NewIndex(d.fold)
+	d.mu.Unlock()
+
+	path := filepath.Join(d.dir, segmentFileName(d.nextSeq, d.nextSeq))
+	cerr := writeSegment(path, d.fold, newIndexSource(flushing))
+	var seg *segment
+	if cerr == nil {
+		if seg, cerr = openSegment(path, d.nextSeq, d.nextSeq, d.fold); cerr != nil {
+			os.Remove(path)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushing = NewIndex(d.fold)
+	if cerr != nil {
+		// 写入失败，文档放回内存中，编号不变
+		for i := 0; i < d.pending.Len(); i++ {
+			flushing.Add(d.pending.Doc(i))
+		}
+		d.pending = flushing
+		return cerr
+	}
+	d.segments = append(d.segments, seg)
+	d.segDocs += seg.docs
+	d.nextSeq++
+	return nil
+}
+
+/*
+ * 把所有段合并成一个，文档编号不变
+ * 合并期间可以继续查询和添加文档
+ */
+func (d *DiskIndex) Merge() *CstError {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	// 持有writeMu时段不会变化
+	d.mu.RLock()
+	segs := append([]*segment(nil), d.segments...)
+	d.mu.RUnlock()
+	if len(segs) < 2 {
+		return nil
+	}
+	first, last := segs[0].first, segs[len(segs)-1].last
+	path := filepath.Join(d.dir, segmentFileName(first, last))
+	if cerr := writeSegment(path, d.fold, newMergeSource(segs)); cerr != nil {
+		return cerr
+	}
+	merged, cerr := openSegment(path, first, last, d.fold)
+	if cerr != nil {
+		return cerr
+	}
+	d.mu.Lock()
+	d.segments = []*segment{merged}
+	d.mu.Unlock()
+	for _, seg := range segs {
+		seg.close()
+		os.Remove(seg.path)
+	}
+	return nil
+}
+
+// 把内存中的文档写入磁盘，然后关闭所有段文件、释放目录的锁，之后不能再使用DiskIndex
+func (d *DiskIndex) Close() *CstError {
+	cerr := d.Flush()
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.close()
+	return cerr
+}
+
+func (d *DiskIndex) close() {
+	for _, seg := range d.segments {
+		seg.close()
+	}
+	d.segments = nil
+	d.segDocs = 0
+	if d.lock != nil {
+		unlockFile(d.lock)
+		d.lock = nil
+	}
+}
+
+// 文档的个数，包括还没有写入磁盘的
+func (d *DiskIndex) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.segDocs + d.flushing.Len() + d.pending.Len()
+}
+
+// 段文件的个数
+func (d *DiskIndex) Segments() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.segments)
+}
+
+// 返回编号为id的文档
+func (d *DiskIndex) Doc(id int) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, seg := range d.segments {
+		if id < seg.docs {
+			return string(seg.doc(id))
+		}
+		id -= seg.docs
+	}
+	if id < d.flushing.Len() {
+		return d.flushing.Doc(id)
+	}
+	return d.pending.Doc(id - d.flushing.Len())
+}
+
+// 返回匹配表达式的所有文档的编号，按编号递增
+func (d *DiskIndex) Search(exp *LogExp) []int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	res := make([]int, 0)
+	base := 0
+	for _, seg := range d.segments {
+		ids, all := selectCandidates(seg, d.fold, exp)
+		if all {
+			for id := 0; id < seg.docs; id++ {
+				// 持有读锁期间段不会被解除映射，可以直接引用映射的内存
+				if exp.Match(bytesToString(seg.doc(id))) {
+					res = append(res, base+id)
+				}
+			}
+		} else {
+			for _, id := range ids {
+				if exp.Match(bytesToString(seg.doc(int(id)))) {
+					res = append(res, base+int(id))
+				}
+			}
+		}
+		base += seg.docs
+	}
+	for _, pending := range []*Index{d.flushing, d.pending} {
+		for _, id := range pending.Search(exp) {
+			res = append(res, base+id)
+		}
+		base += pending.Len()
+	}
+	return res
+}
+
+// 打开段文件，检查文件头和各部分的位置
+func openSegment(path string, first, last int, fold Fold) (*segment, *CstError) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, newCstError(ErrCodeIndexIO, "open segment: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, newCstError(ErrCodeIndexIO, "open segment: %v", err)
+	}
+	if info.Size() < segmentHeaderSize || int64(int(info.Size())) != info.Size() {
+		return nil, newCstError(ErrCodeIndexFormat, "invalid segment size: %v", path)
+	}
+	data, err := mmapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, newCstError(ErrCodeIndexIO, "map segment: %v", err)
+	}
+	seg := &segment{
+		path:     path,
+		first:    first,
+		last:     last,
+		data:     data,
+		docs:     int(binary.LittleEndian.Uint32(data[12:])),
+		grams:    int(binary.LittleEndian.Uint32(data[16:])),
+		postings: int(binary.LittleEndian.Uint32(data[20:])),
+	}
+	if string(data[:8]) != segmentMagic {
+		seg.close()
+		return nil, newCstError(ErrCodeIndexFormat, "not a segment file: %v", path)
+	}
+	if segFold := Fold(binary.LittleEndian.Uint32(data[8:])); segFold != fold {
+		seg.close()
+		return nil, newCstError(ErrCodeIndexFormat, "segment %v was built with fold %v, not %v", path, segFold, fold)
+	}
+	seg.docsAt = segmentHeaderSize + 8*(seg.docs+1)
+	if seg.docsAt > len(data) {
+		seg.close()
+		return nil, newCstError(ErrCodeIndexFormat, "truncated segment: %v", path)
+	}
+	docsLen := binary.LittleEndian.Uint64(data[seg.docsAt-8:])
+	if docsLen > uint64(len(data)-seg.docsAt) {
+		seg.close()
+		return nil, newCstError(ErrCodeIndexFormat, "truncated segment: %v", path)
+	}
+	seg.gramsAt = align4(seg.docsAt + int(docsLen))
+	seg.postingsAt = seg.gramsAt + segmentGramSize*seg.grams
+	if seg.postingsAt+4*seg.postings != len(data) {
+		seg.close()
+		return nil, newCstError(ErrCodeIndexFormat, "truncated segment: %v", path)
+	}
+	if cerr := seg.validate(); cerr != nil {
+		seg.close()
+		return nil, cerr
+	}
+	return seg, nil
+}
+
+/*
+ * 检查段的内容，之后查询时可以直接使用其中的偏移和编号：
+ * 文档的偏移递增；三元组按递增排列，倒排表在postings的范围内；倒排表中的文档编号递增并且小于文档数
+ */
+func (seg *segment) validate() *CstError {
+	prev := uint64(0)
+	for id := 0; id <= seg.docs; id++ {
+		offset := binary.LittleEndian.Uint64(seg.data[segmentHeaderSize+8*id:])
+		if offset < prev {
+			return newCstError(ErrCodeIndexFormat, "corrupted document offsets in segment: %v", seg.path)
+		}
+		prev = offset
+	}
+	for i := 0; i < seg.grams; i++ {
+		g, start, count := seg.gramEntry(i)
+		if i > 0 {
+			if last, _, _ := seg.gramEntry(i - 1); g <= last {
+				return newCstError(ErrCodeIndexFormat, "trigrams are not sorted in segment: %v", seg.path)
+			}
+		}
+		if start+count > seg.postings {
+			return newCstError(ErrCodeIndexFormat, "posting list out of range in segment: %v", seg.path)
+		}
+		at := seg.postingsAt + 4*start
+		for j := 0; j < count; j++ {
+			id := binary.LittleEndian.Uint32(seg.data[at+4*j:])
+			if int64(id) >= int64(seg.docs) || (j > 0 && id <= binary.LittleEndian.Uint32(seg.data[at+4*(j-1):])) {
+				return newCstError(ErrCodeIndexFormat, "corrupted posting list in segment: %v", seg.path)
+			}
+		}
+	}
+	return nil
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func (seg *segment) close() {
+	if seg.data != nil {
+		munmapFile(seg.data)
+		seg.data = nil
+	}
+}
+
+// 段内编号为id的文档，引用映射的内存；偏移损坏时返回nil
+func (seg *segment) doc(id int) []byte {
+	at := segmentHeaderSize + 8*id
+	start := binary.LittleEndian.Uint64(seg.data[at:])
+	end := binary.LittleEndian.Uint64(seg.data[at+8:])
+	docsLen := uint64(seg.gramsAt - seg.docsAt)
+	if start > end || end > docsLen {
+		return nil
+	}
+	return seg.data[seg.docsAt+int(start) : seg.docsAt+int(end)]
+}
+
+// 三元组表中的第i项
+func (seg *segment) gramEntry(i int) (g trigram, start int, count int) {
+	at := seg.gramsAt + segmentGramSize*i
+	return trigram(binary.LittleEndian.Uint32(seg.data[at:])),
+		int(binary.LittleEndian.Uint32(seg.data[at+4:])),
+		int(binary.LittleEndian.Uint32(seg.data[at+8:]))
+}
+
+// 在三元组表中二分查找，返回倒排表在postings中的范围
+func (seg *segment) find(g trigram) (int, int, bool) {
+	i := sort.Search(seg.grams, func(i int) bool {
+		entry, _, _ := seg.gramEntry(i)
+		return entry >= g
+	})
+	if i == seg.grams {
+		return 0, 0, false
+	}
+	entry, start, count := seg.gramEntry(i)
+	if entry != g || start+count > seg.postings {
+		return 0, 0, false
+	}
+	return start, count, true
+}
+
+func (seg *segment) lookup(g trigram) []uint32 {
+	return seg.appendPostings(nil, g, 0)
+}
+
+// 把三元组的倒排表追加到buf，文档编号加上base
+func (seg *segment) appendPostings(buf []uint32, g trigram, base uint32) []uint32 {
+	start, count, ok := seg.find(g)
+	if !ok {
+		return buf
+	}
+	at := seg.postingsAt + 4*start
+	for i := 0; i < count; i++ {
+		buf = append(buf, base+binary.LittleEndian.Uint32(seg.data[at+4*i:]))
+	}
+	return buf
+}
+
+// 写入段文件的数据来源：内存中的文档，或者要合并的多个段
+type segmentSource interface {
+	docCount() int
+	doc(i int) string
+	grams() []trigram // 按递增排列
+	postingCount(g trigram) int
+	appendPostings(buf []uint32, g trigram) []uint32
+}
+
+/*
+ * 写入段文件：先写到临时文件，同步到磁盘之后再改名，所以目录中的段文件总是完整的
+ */
+func writeSegment(path string, fold Fold, src segmentSource) (cerr *CstError) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return newCstError(ErrCodeIndexIO, "create segment: %v", err)
+	}
+	defer func() {
+		if cerr != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriterSize(f, 256*1024)
+	var scratch [segmentGramSize]byte
+	putUint32 := func(v uint32) {
+		binary.LittleEndian.PutUint32(scratch[:4], v)
+		w.Write(scratch[:4])
+	}
+
+	docs := src.docCount()
+	grams := src.grams()
+	counts := make([]int, len(grams))
+	postings := 0
+	for i, g := range grams {
+		counts[i] = src.postingCount(g)
+		postings += counts[i]
+	}
+
+	w.WriteString(segmentMagic)
+	putUint32(uint32(fold))
+	putUint32(uint32(docs))
+	putUint32(uint32(len(grams)))
+	putUint32(uint32(postings))
+
+	var offset uint64
+	for i := 0; i <= docs; i++ {
+		binary.LittleEndian.PutUint64(scratch[:8], offset)
+		w.Write(scratch[:8])
+		if i < docs {
+			offset += uint64(len(src.doc(i)))
+		}
+	}
+	for i := 0; i < docs; i++ {
+		w.WriteString(src.doc(i))
+	}
+	docsAt := segmentHeaderSize + 8*(docs+1)
+	for n := docsAt + int(offset); n%4 != 0; n++ {
+		w.WriteByte(0)
+	}
+
+	start := 0
+	for i, g := range grams {
+		putUint32(uint32(g))
+		putUint32(uint32(start))
+		putUint32(uint32(counts[i]))
+		start += counts[i]
+	}
+	var buf []uint32
+	for _, g := range grams {
+		buf = src.appendPostings(buf[:0], g)
+		for _, id := range buf {
+			putUint32(id)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return newCstError(ErrCodeIndexIO, "write segment: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		return newCstError(ErrCodeIndexIO, "sync segment: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return newCstError(ErrCodeIndexIO, "close segment: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return newCstError(ErrCodeIndexIO, "rename segment: %v", err)
+	}
+	// 同步目录，确保改名也写入磁盘；有的平台不支持同步目录，忽略错误
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// 内存中的文档作为段文件的数据来源，调用方需要保证写入期间idx不被修改
+type indexSource struct {
+	idx       *Index
+	gramOrder []trigram
+}
+
+func newIndexSource(idx *Index) *indexSource {
+	grams := make([]trigram, 0, len(idx.postings))
+	for g := range idx.postings {
+		grams = append(grams, g)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		return grams[i] < grams[j]
+	})
+	return &indexSource{idx: idx, gramOrder: grams}
+}
+
+func (s *indexSource) docCount() int {
+	return len(s.idx.docs)
+}
+
+func (s *indexSource) doc(i int) string {
+	return s.idx.docs[i]
+}
+
+func (s *indexSource) grams() []trigram {
+	return s.gramOrder
+}
+
+func (s *indexSource) postingCount(g trigram) int {
+	return len(s.idx.postings[g])
+}
+
+func (s *indexSource) appendPostings(buf []uint32, g trigram) []uint32 {
+	return append(buf, s.idx.postings[g]...)
+}
+
+// 多个段按顺序拼接作为段文件的数据来源，后面的段的文档编号依次后移
+type mergeSource struct {
+	segs      []*segment
+	bases     []int // 每个段的第一篇文档在合并后的编号
+	docs      int
+	gramOrder []trigram
+}
+
+func newMergeSource(segs []*segment) *mergeSource {
+	s := &mergeSource{segs: segs, bases: make([]int, len(segs))}
+	seen := make(map[trigram]bool)
+	for i, seg := range segs {
+		s.bases[i] = s.docs
+		s.docs += seg.docs
+		for j := 0; j < seg.grams; j++ {
+			g, _, _ := seg.gramEntry(j)
+			if !seen[g] {
+				seen[g] = true
+				s.gramOrder = append(s.gramOrder, g)
+			}
+		}
+	}
+	sort.Slice(s.gramOrder, func(i, j int) bool {
+		return s.gramOrder[i] < s.gramOrder[j]
+	})
+	return s
+}
+
+func (s *mergeSource) docCount() int {
+	return s.docs
+}
+
+func (s *mergeSource) doc(i int) string {
+	k := sort.Search(len(s.bases), func(k int) bool {
+		return s.bases[k] > i
+	}) - 1
+	return bytesToString(s.segs[k].doc(i - s.bases[k]))
+}
+
+func (s *mergeSource) grams() []trigram {
+	return s.gramOrder
+}
+
+func (s *mergeSource) postingCount(g trigram) int {
+	count := 0
+	for _, seg := range s.segs {
+		if _, n, ok := seg.find(g); ok {
+			count += n
+		}
+	}
+	return count
+}
+
+func (s *mergeSource) appendPostings(buf []uint32, g trigram) []uint32 {
+	for i, seg := range s.segs {
+		buf = seg.appendPostings(buf, g, uint32(s.bases[i]))
+	}
+	return buf
+}
@@ -17,8 +17,18 @@ func (err *CstError) Error() string {
 }
 
 var (
-	ErrCodeUnknown           = 10001 // not sure exactly the error meaning
-	ErrCodeInvalidExpression = 10002 // invalid expression
+	ErrCodeUnknown            = 10001 // not sure exactly the error meaning
+	ErrCodeInvalidExpression  = 10002 // invalid expression
+	ErrCodeTooLong            = 10003 // expression exceeds CompileOptions.MaxLength
+	ErrCodeTooDeep            = 10004 // expression exceeds CompileOptions.MaxDepth
+	ErrCodeTooManyKeywords    = 10005 // expression exceeds CompileOptions.MaxKeywords
+	ErrCodeTooManyNodes       = 10006 // expression exceeds CompileOptions.MaxNodes
+	ErrCodeUndefinedName      = 10007 // @name is not defined in CompileOptions.Registry
+	ErrCodeCircularDefinition = 10008 // definitions in CompileOptions.Registry reference each other in a cycle
+	ErrCodeMissingValue       = 10009 // no value for a placeholder when instantiating a Template
+	ErrCodeIndexIO            = 10010 // reading or writing the files of a DiskIndex failed
+	ErrCodeIndexFormat        = 10011 // a segment file of a DiskIndex is corrupt or was built with a different Fold
+	ErrCodeIndexLocked        = 10012 // the directory of a DiskIndex is already opened by another DiskIndex
 )
 
 func newCstError(code int, format string, a ...interface{}) *CstError {
@@ -1,28 +1,29 @@
 package logexp
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
 
 // 元表达式
 type ExpressionMeta struct {
 	Type       ExpressionType `json:"type"`
 	IsNegative bool           `json:"is_negative"` // 是否取非
 	Keyword    string         `json:"keyword"`     // 关键词
+	syntax     Syntax         // 编译时的语法，决定文本形式中关键词的写法
 }
 
 func (e *ExpressionMeta) GetIsNegative() bool {
 	return e.IsNegative
 }
 
-func (e *ExpressionMeta) ReverseIsNegative() {
-	e.IsNegative = !e.IsNegative
-}
-
 func (e *ExpressionMeta) GetType() ExpressionType {
 	return e.Type
 }
 
 func (e *ExpressionMeta) GetExps() []IExpression {
-	return []IExpression{}
+	return nil
 }
 
 func (e *ExpressionMeta) Match(text string) bool {
@@ -36,19 +37,244 @@ func (e *ExpressionMeta) Match(text string) bool {
 	return res
 }
 
+func (e *ExpressionMeta) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionMeta) String() string {
+	if e.IsNegative {
+		return "!" + quoteKeyword(e.Keyword, e.syntax)
+	}
+	return quoteKeyword(e.Keyword, e.syntax)
+}
+
+// 说明关键词出现的位置
+func (e *ExpressionMeta) explain(text string) string {
+	if i := strings.Index(text, e.Keyword); i >= 0 {
+		return fmt.Sprintf("found at offset %v", i)
+	}
+	return "not found"
+}
+
+/*
+ * 关键词的文本形式，用编译时的选项重新编译时得到同样的关键词
+ * 启用了短语语法时，会被当成其他写法的关键词还原成短语的形式；否则关键词按原样输出，编译时已经保证其中没有语法符号
+ */
+func quoteKeyword(keyword string, syntax Syntax) string {
+	if syntax&Syntax_ImplicitAnd == 0 || !needsQuote(keyword, syntax) {
+		return keyword
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range keyword {
+		// 形似引号的字符在Syntax_FullWidth下也会结束短语
+		if c == '\\' || c == '"' || lookalikeQuotes[c] {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+/*
+ * 关键词按原样输出时，在给定的语法下会不会被当成别的写法：
+ * 含有运算符、引号或者空白；以修饰符、锚定、引用或者占位符的符号开头；以锚定的$或者模糊的~N结尾；是关键字运算符；
+ * 含有区间的括号，或者能解析成数值比较
+ */
+func needsQuote(keyword string, syntax Syntax) bool {
+	if keyword == "" || strings.ContainsAny(keyword, "|&!()\"") || strings.IndexFunc(keyword, unicode.IsSpace) >= 0 {
+		return true
+	}
+	runes := []rune(keyword)
+	if syntax&Syntax_FullWidth != 0 {
+		for _, c := range runes {
+			if _, ok := lookalikeOperators[c]; ok || lookalikeQuotes[c] {
+				return true
+			}
+		}
+	}
+	if strings.ContainsRune("-+^=@{", runes[0]) || runes[len(runes)-1] == '$' {
+		return true
+	}
+	if _, _, ok := splitFuzzy(runes); ok {
+		return true
+	}
+	for _, w := range wordOperators {
+		if strings.EqualFold(keyword, w.word) {
+			return true
+		}
+	}
+	if syntax&(Syntax_Compare|Syntax_Time) != 0 && strings.ContainsAny(keyword, "[{") {
+		return true
+	}
+	if syntax&Syntax_Compare != 0 {
+		if cmp, cerr := (&parser{}).parseCompare(keyword, false); cmp != nil || cerr != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否启用了短语语法，只有短语里的关键词可以含有语法符号
+func (p *parser) phrase() bool {
+	return p.opts.Syntax&Syntax_ImplicitAnd != 0
+}
+
+/*
+ * 关键词节点记录的语法，决定文本形式中关键词的写法
+ * 模板的值按原样作为关键词，含有基础语法写不出的语法符号时按短语语法输出，启用了短语语法时重新编译得到同样的关键词
+ */
+func (p *parser) keywordSyntax(keyword string) Syntax {
+	if p.literal && strings.ContainsAny(keyword, "|&!()") {
+		return p.opts.Syntax | Syntax_ImplicitAnd
+	}
+	return p.opts.Syntax
+}
+
+/*
+ * 检查关键词能否写成文本形式：没有启用短语语法时，关键词中不能有语法符号
+ * 规范化、同义词、模板的值都可能带来语法符号，例如Fold_NFKC把“ａ｜ｂ”折叠成“a|b”
+ */
+func (p *parser) checkKeyword(keyword string) *CstError {
+	if !p.phrase() && !p.literal && strings.ContainsAny(keyword, "|&!()") {
+		return newCstError(ErrCodeInvalidExpression, "keyword contains syntax symbols, which is only allowed in phrases (Syntax_ImplicitAnd): %v", keyword)
+	}
+	return nil
+}
+
 func NewExpressionMeta(exp []rune, isNegative bool) (IExpression, *CstError) {
+	if cerr := checkMetaExp(exp); cerr != nil {
+		return nil, cerr
+	}
+	expMeta := ExpressionMeta{
+		Type:       ExpressionType_Meta,
+		IsNegative: isNegative,
+		Keyword:    string(exp),
+	}
+	return &expMeta, nil
+}
+
+// 元表达式内部不能出现任何语法符号
+func checkMetaExp(exp []rune) *CstError {
 	mapNotInclude := map[rune]struct{}{
 		'|': {}, '&': {}, '!': {}, '(': {}, ')': {},
 	}
 	for _, c := range exp {
 		if _, ok := mapNotInclude[c]; ok {
-			return nil, newCstError(ErrCodeInvalidExpression, "invalid meta expression: %v", string(exp))
+			return newCstError(ErrCodeInvalidExpression, "invalid meta expression: %v", string(exp))
 		}
 	}
-	expMeta := ExpressionMeta{
+	return nil
+}
+
+/*
+ * @Param depth: 元表达式所在的“或”、“且”表达式的嵌套层数
+ */
+func (p *parser) parseMeta(exp []rune, isNegative bool, depth int) (IExpression, *CstError) {
+	if cerr := p.enterMeta(); cerr != nil {
+		return nil, cerr
+	}
+	// 锚定的关键词^keyword、keyword$、=keyword，关键词部分也可以是短语
+	var anchor Anchor
+	if p.opts.Syntax&Syntax_Anchors != 0 {
+		exp, anchor = splitAnchor(exp)
+	}
+	// 模糊关键词keyword~N，关键词部分也可以是短语
+	distance, isFuzzy := 0, false
+	if p.opts.Syntax&Syntax_Fuzzy != 0 && anchor == 0 {
+		exp, distance, isFuzzy = splitFuzzy(exp)
+	}
+	keyword := string(exp)
+	// 短语里的字符都属于关键词，不再解析成引用、时间、比较等写法
+	isPhrase := p.phrase() && strings.ContainsRune(keyword, '"')
+	isPlain := anchor == 0 && !isFuzzy && !isPhrase
+	if isPlain {
+		if ph := p.parsePlaceholder(keyword, isNegative); ph != nil {
+			return ph, nil
+		}
+		ref, cerr := p.parseRef(keyword, isNegative, depth)
+		if ref != nil || cerr != nil {
+			return ref, cerr
+		}
+	}
+	if p.opts.Syntax&Syntax_Time != 0 && isPlain {
+		tm, cerr := p.parseTime(keyword, isNegative)
+		if tm != nil || cerr != nil {
+			return tm, cerr
+		}
+	}
+	if p.opts.Syntax&Syntax_Compare != 0 && isPlain {
+		cmp, cerr := p.parseCompare(keyword, isNegative)
+		if cmp != nil || cerr != nil {
+			return cmp, cerr
+		}
+	}
+	if isPhrase {
+		// 短语必须是一个完整的词
+		var ok bool
+		keyword, ok = unquotePhrase(exp)
+		if !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid phrase: %v", string(exp))
+		}
+	} else if cerr := checkMetaExp(exp); cerr != nil {
+		return nil, cerr
+	}
+	if anchor != 0 {
+		keyword = p.foldKeyword(keyword)
+		if cerr := p.checkKeyword(keyword); cerr != nil {
+			return nil, cerr
+		}
+		return &ExpressionAnchor{
+			Type:       ExpressionType_Anchor,
+			IsNegative: isNegative,
+			Keyword:    keyword,
+			Anchor:     anchor,
+			syntax:     p.keywordSyntax(keyword),
+		}, nil
+	}
+	if isFuzzy {
+		return p.newFuzzy(keyword, isNegative, distance)
+	}
+	return p.newMeta(keyword, isNegative)
+}
+
+// 构造元表达式，关键词有同义词时展开成关键词及其所有同义词组成的“或”表达式
+func (p *parser) newMeta(keyword string, isNegative bool) (IExpression, *CstError) {
+	synonyms := p.synonymsOf(keyword)
+	if len(synonyms) == 0 {
+		return p.newKeyword(keyword, isNegative)
+	}
+	exps := make([]IExpression, 0, len(synonyms)+1)
+	seen := make(map[string]bool, len(synonyms)+1)
+	for _, word := range append([]string{keyword}, synonyms...) {
+		if folded := p.foldKeyword(word); !seen[folded] {
+			seen[folded] = true
+			exp, cerr := p.newKeyword(word, false)
+			if cerr != nil {
+				return nil, cerr
+			}
+			exps = append(exps, exp)
+		}
+	}
+	return newGroup(ExpressionType_Or, exps, isNegative), nil
+}
+
+// 构造单个关键词的元表达式，关键词按编译选项做规范化；启用拼音匹配时，拼音关键词构造成拼音表达式
+func (p *parser) newKeyword(keyword string, isNegative bool) (IExpression, *CstError) {
+	keyword = p.foldKeyword(keyword)
+	if cerr := p.checkKeyword(keyword); cerr != nil {
+		return nil, cerr
+	}
+	if p.opts.Pinyin != 0 && isPinyinKeyword(keyword) {
+		return newPinyin(keyword, isNegative, p.opts.Pinyin, p.keywordSyntax(keyword)), nil
+	}
+	return &ExpressionMeta{
 		Type:       ExpressionType_Meta,
 		IsNegative: isNegative,
-		Keyword:    string(exp),
-	}
-	return &expMeta, nil
+		Keyword:    keyword,
+		syntax:     p.keywordSyntax(keyword),
+	}, nil
 }
@@ -0,0 +1,100 @@
+package logexp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 表达式对一段文本的匹配过程
+type Explanation struct {
+	Expression string         `json:"expression"`         // 节点的表达式
+	Type       ExpressionType `json:"type"`               // 节点的类型
+	Match      bool           `json:"match"`              // 节点的匹配结果（已经计入取非）
+	Detail     string         `json:"detail,omitempty"`   // 叶子节点的匹配说明，例如关键词出现的位置
+	Children   []*Explanation `json:"children,omitempty"` // 子表达式的匹配过程
+}
+
+// 能够说明自身匹配情况的叶子节点
+type explainer interface {
+	explain(text string) string
+}
+
+/*
+ * 计算表达式树的每个节点对text的匹配结果
+ * 跟Match不同，不会短路求值，所有子表达式都会被计算
+ * 被多处引用的同一个“或”、“且”表达式（例如展开多次的定义）只计算一次，各处共用同一个*Explanation
+ */
+func Explain(exp IExpression, text string) *Explanation {
+	return explain(exp, text, make(map[IExpression]*Explanation), make(map[IExpression]string))
+}
+
+func explain(exp IExpression, text string, memo map[IExpression]*Explanation, strs map[IExpression]string) *Explanation {
+	group := isGroup(exp)
+	if group {
+		if res, ok := memo[exp]; ok {
+			return res
+		}
+	}
+	res := &Explanation{
+		Expression: expString(exp, strs),
+		Type:       exp.GetType(),
+	}
+	exps := exp.GetExps()
+	if len(exps) > 0 {
+		res.Children = make([]*Explanation, len(exps))
+		for i := range exps {
+			res.Children[i] = explain(exps[i], text, memo, strs)
+		}
+	} else if e, ok := exp.(explainer); ok {
+		res.Detail = e.explain(text)
+	}
+	if group {
+		// 本包的“或”、“且”表达式由子表达式的结果得出，不再重新匹配
+		isAnd := exp.GetType() == ExpressionType_And
+		res.Match = isAnd
+		for _, child := range res.Children {
+			if child.Match != isAnd {
+				res.Match = !isAnd
+				break
+			}
+		}
+		res.Match = res.Match != exp.GetIsNegative()
+		memo[exp] = res
+	} else {
+		res.Match = exp.Match(text)
+	}
+	return res
+}
+
+// 缩进的文本形式，每个节点一行；共用的节点只在第一次出现时展开子节点
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	e.write(&sb, 0, make(map[*Explanation]bool))
+	return sb.String()
+}
+
+func (e *Explanation) write(sb *strings.Builder, depth int, written map[*Explanation]bool) {
+	mark := "[miss]"
+	if e.Match {
+		mark = "[hit] "
+	}
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(fmt.Sprintf("%v %v", mark, e.Expression))
+	if e.Detail != "" {
+		sb.WriteString(fmt.Sprintf(" (%v)", e.Detail))
+	}
+	if len(e.Children) > 0 && written[e] {
+		sb.WriteString(" (same as above)\n")
+		return
+	}
+	written[e] = true
+	sb.WriteString("\n")
+	for _, child := range e.Children {
+		child.write(sb, depth+1, written)
+	}
+}
+
+// 说明表达式对text的匹配过程，text跟Match一样先做规范化
+func (e *LogExp) Explain(text string) *Explanation {
+	return Explain(e.expression, foldString(text, e.fold))
+}
@@ -0,0 +1,222 @@
+package logexp
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// 模糊关键词的最大长度（字符数），位并行算法用一个uint64表示关键词的每一个字符
+const maxFuzzyKeywordLength = 64
+
+/*
+ * 模糊表达式：文本中存在跟关键词的编辑距离不超过Distance的子串即算匹配
+ * 编辑距离在Levenshtein距离的基础上，把相邻两个字符交换位置也算作一次编辑，例如paymnet跟payment的距离为1
+ */
+type ExpressionFuzzy struct {
+	Type       ExpressionType `json:"type"`
+	IsNegative bool           `json:"is_negative"` // 是否取非
+	Keyword    string         `json:"keyword"`     // 关键词
+	Distance   int            `json:"distance"`    // 允许的最大编辑距离
+	peq        map[rune]uint64
+	syntax     Syntax // 编译时的语法，决定文本形式中关键词的写法
+}
+
+func (e *ExpressionFuzzy) GetIsNegative() bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionFuzzy) GetType() ExpressionType {
+	return e.Type
+}
+
+func (e *ExpressionFuzzy) GetExps() []IExpression {
+	return nil
+}
+
+func (e *ExpressionFuzzy) Match(text string) bool {
+	_, distance := e.search(text)
+	res := distance <= e.Distance
+	if e.IsNegative {
+		res = !res
+	}
+	return res
+}
+
+/*
+ * Myers位并行算法（Hyyrö扩展了相邻字符交换），逐个字符扫描文本，计算关键词跟以每个位置结尾的子串的最小编辑距离
+ * 找到距离不超过Distance的子串时立即返回子串结尾的字节位置和距离，否则返回-1和找到的最小距离
+ */
+func (e *ExpressionFuzzy) search(text string) (int, int) {
+	peq := e.peq
+	if peq == nil {
+		// 不是通过编译构造的表达式
+		peq = buildPeq(e.Keyword)
+	}
+	m := utf8.RuneCountInString(e.Keyword)
+	if m == 0 || m > maxFuzzyKeywordLength {
+		return -1, m
+	}
+	high := uint64(1) << uint(m-1)
+	pv := ^uint64(0)
+	mv := uint64(0)
+	d0 := uint64(0)
+	prevEq := uint64(0)
+	score := m
+	best := m
+	if score <= e.Distance {
+		return 0, score
+	}
+	for i, r := range text {
+		eq := peq[r]
+		// 上一个文本字符跟关键词的下一个字符相同、当前文本字符跟关键词的当前字符相同时，可以交换
+		tr := ((^d0 & eq) << 1) & prevEq
+		d0 = (((eq & pv) + pv) ^ pv) | eq | mv | tr
+		ph := mv | ^(d0 | pv)
+		mh := pv & d0
+		if ph&high != 0 {
+			score++
+		} else if mh&high != 0 {
+			score--
+		}
+		// 子串可以从文本的任意位置开始，所以第0行的水平差值始终为0，左移后不补1
+		ph <<= 1
+		mh <<= 1
+		pv = mh | ^(d0 | ph)
+		mv = ph & d0
+		prevEq = eq
+		if score < best {
+			best = score
+		}
+		if score <= e.Distance {
+			return i + utf8.RuneLen(r), score
+		}
+	}
+	return -1, best
+}
+
+func (e *ExpressionFuzzy) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionFuzzy) String() string {
+	s := quoteKeyword(e.Keyword, e.syntax) + "~" + strconv.Itoa(e.Distance)
+	if e.IsNegative {
+		return "!" + s
+	}
+	return s
+}
+
+// 说明匹配到的子串及其编辑距离
+func (e *ExpressionFuzzy) explain(text string) string {
+	end, distance := e.search(text)
+	if end < 0 {
+		return fmt.Sprintf("no substring within distance %v, closest distance %v", e.Distance, distance)
+	}
+	start := fuzzyStart(text, end, e.Keyword, distance)
+	return fmt.Sprintf("found %q at offset %v, distance %v", text[start:end], start, distance)
+}
+
+// 关键词中每个字符出现的位置的位图
+func buildPeq(keyword string) map[rune]uint64 {
+	peq := make(map[rune]uint64)
+	i := 0
+	for _, r := range keyword {
+		peq[r] |= 1 << uint(i)
+		i++
+	}
+	return peq
+}
+
+// 找到以end结尾、跟关键词的编辑距离为distance的最长子串的开始位置
+func fuzzyStart(text string, end int, keyword string, distance int) int {
+	pattern := []rune(keyword)
+	start := end
+	for n := 0; start > 0 && n < len(pattern)+distance; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	for start < end {
+		if editDistance(pattern, []rune(text[start:end])) == distance {
+			return start
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		start += size
+	}
+	return end
+}
+
+// 两个字符串的编辑距离，相邻字符交换算一次编辑（每个字符最多参与一次交换）
+func editDistance(a []rune, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev2, prev, row = prev, row, prev2
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			row[j] = minInt(minInt(prev[j]+1, row[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				row[j] = minInt(row[j], prev2[j-2]+1)
+			}
+		}
+	}
+	return row[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+/*
+ * 拆分模糊关键词的写法keyword~N，不是这种写法时返回false
+ */
+func splitFuzzy(exp []rune) ([]rune, int, bool) {
+	i := len(exp)
+	for i > 0 && exp[i-1] >= '0' && exp[i-1] <= '9' {
+		i--
+	}
+	if i == len(exp) || i < 2 || exp[i-1] != '~' || len(exp)-i > 2 {
+		return exp, 0, false
+	}
+	distance, _ := strconv.Atoi(string(exp[i:]))
+	return exp[:i-1], distance, true
+}
+
+// 构造模糊表达式，编辑距离为0时就是普通的元表达式
+func (p *parser) newFuzzy(keyword string, isNegative bool, distance int) (IExpression, *CstError) {
+	if distance == 0 {
+		return p.newMeta(keyword, isNegative)
+	}
+	keyword = p.foldKeyword(keyword)
+	if cerr := p.checkKeyword(keyword); cerr != nil {
+		return nil, cerr
+	}
+	n := utf8.RuneCountInString(keyword)
+	if n > maxFuzzyKeywordLength {
+		return nil, newCstError(ErrCodeInvalidExpression, "fuzzy keyword is longer than %v characters: %v", maxFuzzyKeywordLength, keyword)
+	}
+	if distance >= n {
+		return nil, newCstError(ErrCodeInvalidExpression, "edit distance %v is not less than the length of fuzzy keyword: %v", distance, keyword)
+	}
+	return &ExpressionFuzzy{
+		Type:       ExpressionType_Fuzzy,
+		IsNegative: isNegative,
+		Keyword:    keyword,
+		Distance:   distance,
+		peq:        buildPeq(keyword),
+		syntax:     p.keywordSyntax(keyword),
+	}, nil
+}
@@ -0,0 +1,225 @@
+package logexp
+
+import (
+	"sort"
+	"sync"
+)
+
+// 倒排索引的n-gram长度（字节数）
+const gramSize = 3
+
+// 文本中连续gramSize个字节，按大端序放进一个整数
+type trigram uint32
+
+/*
+ * 文档集合上的三元组（trigram）倒排索引，用来执行LogExp查询而不扫描所有文档
+ * 查询时，“或”、“且”表达式被转换成倒排表的并集、交集，选出候选文档，再用Match逐个验证，所以结果跟逐条Match完全相同
+ * 只有关键词长度不小于gramSize个字节、并且没有取非的元表达式和锚定表达式能缩小候选范围，其他叶子节点不限制候选文档
+ * 索引建立时文档按Fold规范化；查询的Fold跟索引不同时，关键词无法使用索引，退化成验证所有文档
+ * Index可以被多个goroutine并发使用
+ */
+type Index struct {
+	mu       sync.RWMutex
+	fold     Fold
+	docs     []string
+	postings map[trigram][]uint32 // 每个三元组出现的文档，按文档编号递增
+}
+
+/*
+ * @Param fold: 建立索引前对文档做的规范化，应该跟查询的编译选项中的Fold一致
+ */
+func NewIndex(fold Fold) *Index {
+	return &Index{
+		fold:     fold,
+		postings: make(map[trigram][]uint32),
+	}
+}
+
+// 添加一篇文档，返回文档编号，编号从0开始递增
+func (idx *Index) Add(doc string) int {
+	folded := foldString(doc, idx.fold)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	id := uint32(len(idx.docs))
+	idx.docs = append(idx.docs, doc)
+	for i := 0; i+gramSize <= len(folded); i++ {
+		g := gramAt(folded, i)
+		list := idx.postings[g]
+		// 同一篇文档中重复的三元组只记录一次
+		if len(list) == 0 || list[len(list)-1] != id {
+			idx.postings[g] = append(list, id)
+		}
+	}
+	return int(id)
+}
+
+func gramAt(s string, i int) trigram {
+	return trigram(s[i])<<16 | trigram(s[i+1])<<8 | trigram(s[i+2])
+}
+
+// 文档的个数
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// 返回编号为id的文档
+func (idx *Index) Doc(id int) string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.docs[id]
+}
+
+// 返回匹配表达式的所有文档的编号，按编号递增
+func (idx *Index) Search(exp *LogExp) []int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	res := make([]int, 0)
+	ids, all := idx.candidates(exp)
+	if all {
+		for id := range idx.docs {
+			if exp.Match(idx.docs[id]) {
+				res = append(res, id)
+			}
+		}
+		return res
+	}
+	for _, id := range ids {
+		if exp.Match(idx.docs[id]) {
+			res = append(res, int(id))
+		}
+	}
+	return res
+}
+
+// 选出可能匹配表达式的候选文档，调用方需要持有读锁
+func (idx *Index) candidates(exp *LogExp) ([]uint32, bool) {
+	return selectCandidates(idx, idx.fold, exp)
+}
+
+func (idx *Index) lookup(g trigram) []uint32 {
+	return idx.postings[g]
+}
+
+// 倒排表的来源：内存中的Index，或者DiskIndex的一个段
+type postingSource interface {
+	lookup(g trigram) []uint32 // 三元组的倒排表，三元组不存在时返回nil
+}
+
+/*
+ * 选出可能匹配表达式的候选文档，all为true表示索引无法缩小范围、所有文档都是候选
+ * @Param fold: 建立索引时对文档做的规范化
+ */
+func selectCandidates(src postingSource, fold Fold, exp *LogExp) ([]uint32, bool) {
+	if exp.fold != fold {
+		return nil, true
+	}
+	return planPostings(src, exp.expression)
+}
+
+// 把表达式树转换成倒排表的并集、交集
+func planPostings(src postingSource, exp IExpression) ([]uint32, bool) {
+	// 取非的表达式匹配的是不含某些内容的文档，倒排表无法表示
+	if exp.GetIsNegative() {
+		return nil, true
+	}
+	switch e := exp.(type) {
+	case *ExpressionMeta:
+		return keywordPostings(src, e.Keyword)
+	case *ExpressionAnchor:
+		return keywordPostings(src, e.Keyword)
+	case *ExpressionAnd:
+		lists := make([][]uint32, 0, len(e.Exps))
+		for i := range e.Exps {
+			ids, all := planPostings(src, e.Exps[i])
+			if !all {
+				lists = append(lists, ids)
+			}
+		}
+		if len(lists) == 0 {
+			return nil, true
+		}
+		return intersectAll(lists), false
+	case *ExpressionOr:
+		var res []uint32
+		for i := range e.Exps {
+			ids, all := planPostings(src, e.Exps[i])
+			if all {
+				return nil, true
+			}
+			res = union(res, ids)
+		}
+		return res, false
+	}
+	return nil, true
+}
+
+// 含有关键词的候选文档：关键词的所有三元组的倒排表的交集
+func keywordPostings(src postingSource, keyword string) ([]uint32, bool) {
+	if len(keyword) < gramSize {
+		return nil, true
+	}
+	lists := make([][]uint32, 0, len(keyword)-gramSize+1)
+	for i := 0; i+gramSize <= len(keyword); i++ {
+		list := src.lookup(gramAt(keyword, i))
+		if len(list) == 0 {
+			return nil, false
+		}
+		lists = append(lists, list)
+	}
+	return intersectAll(lists), false
+}
+
+// 多个倒排表的交集，从最短的开始求交
+func intersectAll(lists [][]uint32) []uint32 {
+	sort.Slice(lists, func(i, j int) bool {
+		return len(lists[i]) < len(lists[j])
+	})
+	res := lists[0]
+	for _, list := range lists[1:] {
+		if len(res) == 0 {
+			break
+		}
+		res = intersect(res, list)
+	}
+	return res
+}
+
+func intersect(a, b []uint32) []uint32 {
+	res := make([]uint32, 0, len(a))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+func union(a, b []uint32) []uint32 {
+	res := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			res = append(res, a[i])
+			i++
+		case a[i] > b[j]:
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
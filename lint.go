@@ -0,0 +1,42 @@
+package logexp
+
+import "fmt"
+
+// 表达式检查发现的可疑之处，不影响编译
+type LintWarning struct {
+	Keyword string `json:"keyword"` // 可疑的关键词
+	Message string `json:"msg"`     // 说明
+}
+
+type linter struct {
+	warnings []*LintWarning
+}
+
+func (l *linter) Enter(exp IExpression) bool {
+	if meta, ok := exp.(*ExpressionMeta); ok {
+		l.checkKeyword(meta.Keyword)
+	}
+	return true
+}
+
+func (l *linter) Leave(exp IExpression) {}
+
+func (l *linter) checkKeyword(keyword string) {
+	for _, c := range keyword {
+		if op, ok := lookalikeOperators[c]; ok {
+			// 多半是输入法切到了全角，本意是运算符
+			l.warnings = append(l.warnings, &LintWarning{
+				Keyword: keyword,
+				Message: fmt.Sprintf("keyword contains %q which looks like operator %q, consider Syntax_FullWidth", c, op),
+			})
+			return
+		}
+	}
+}
+
+// 检查表达式中可疑的写法，没有发现问题时返回空切片
+func (e *LogExp) Lint() []*LintWarning {
+	l := linter{warnings: make([]*LintWarning, 0)}
+	Walk(e.expression, &l)
+	return l.warnings
+}
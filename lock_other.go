@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package logexp
+
+import "os"
+
+// 不支持flock的平台上，独占地创建锁文件；进程异常退出时残留的锁文件需要手动删除
+func lockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+}
+
+func unlockFile(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
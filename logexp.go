@@ -8,31 +8,41 @@
 
 package logexp
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
 type ExpressionType int32 // 表达式类型
 const (
-	ExpressionType_Meta ExpressionType = 0 // 元表达式（内部不包含'|'和'&'符号）
-	ExpressionType_Or   ExpressionType = 1 // “或”表达式
-	ExpressionType_And  ExpressionType = 2 // “且”表达式
+	ExpressionType_Meta        ExpressionType = 0 // 元表达式（内部不包含'|'和'&'符号）
+	ExpressionType_Or          ExpressionType = 1 // “或”表达式
+	ExpressionType_And         ExpressionType = 2 // “且”表达式
+	ExpressionType_Pinyin      ExpressionType = 3 // 拼音表达式（用拼音书写的关键词，见CompileOptions.Pinyin）
+	ExpressionType_Fuzzy       ExpressionType = 4 // 模糊表达式（keyword~N，见Syntax_Fuzzy）
+	ExpressionType_Compare     ExpressionType = 5 // 比较表达式（key>N、key:[A TO B]，见Syntax_Compare）
+	ExpressionType_Time        ExpressionType = 6 // 时间表达式（@time>=T、@time in last 15m，见Syntax_Time）
+	ExpressionType_Anchor      ExpressionType = 7 // 锚定表达式（^keyword、keyword$、=keyword，见Syntax_Anchors）
+	ExpressionType_Placeholder ExpressionType = 8 // 占位符表达式（模板中的{name}，见Template）
 )
 
+/*
+ * 编译后的表达式树是只读的：编译过程中的状态都保存在subExpScanner里，不会留在树上
+ * 需要变换表达式时，使用Rewrite生成新的树（未变化的子树会被复用），所以同一棵树可以被多个goroutine并发使用
+ */
 type IExpression interface {
 	/*
 	 * 返回取非的标记
 	 */
 	GetIsNegative() bool
-	/*
-	 * 逆转取非的标记
-	 */
-	ReverseIsNegative()
 	/*
 	 * 返回表达式类型
 	 */
 	GetType() ExpressionType
 
 	/*
-	 * 返回所有子表达式
+	 * 返回所有子表达式，返回的切片属于表达式树本身，调用方不能修改
 	 */
 	GetExps() []IExpression
 
@@ -42,6 +52,15 @@ type IExpression interface {
 	Match(text string) bool
 }
 
+/*
+ * 表达式的文本形式，用编译时的选项重新编译得到同样的表达式
+ * 例外是模板的实例：含有语法符号的值写成短语，只有启用了Syntax_ImplicitAnd时才能重新编译得到同样的表达式
+ * 包内的表达式都实现了fmt.Stringer；包外实现的表达式没有实现fmt.Stringer时，使用fmt的默认格式
+ */
+func expressionString(exp IExpression) string {
+	return expString(exp, make(map[IExpression]string))
+}
+
 // 子表达式
 type SubExp struct {
 	IsNegative   bool   // 是否取非
@@ -79,12 +98,137 @@ func (e *SubExp) Trim() bool {
 	}
 }
 
+/*
+ * 表达式的文本形式，子表达式是“或”、“且”表达式时加上括号
+ * 共用的子表达式（例如展开多次的定义）只生成一次文本，结果记在memo里
+ */
+func expString(exp IExpression, memo map[IExpression]string) string {
+	sep := "|"
+	switch exp.(type) {
+	case *ExpressionAnd:
+		sep = "&"
+	case *ExpressionOr:
+	default:
+		if s, ok := exp.(fmt.Stringer); ok {
+			return s.String()
+		}
+		return fmt.Sprintf("%v", exp)
+	}
+	if s, ok := memo[exp]; ok {
+		return s
+	}
+	exps := exp.GetExps()
+	parts := make([]string, len(exps))
+	for i := range exps {
+		s := expString(exps[i], memo)
+		if len(exps[i].GetExps()) > 0 && !exps[i].GetIsNegative() {
+			s = "(" + s + ")"
+		}
+		parts[i] = s
+	}
+	s := strings.Join(parts, sep)
+	if exp.GetIsNegative() {
+		s = "!(" + s + ")"
+	}
+	memo[exp] = s
+	return s
+}
+
+// 子表达式扫描器，把表达式按当前层级的连接符sep切分成子表达式
+type subExpScanner struct {
+	orgExp []rune // 原始表达式
+	iter   int    // 遍历原表达式的浮标
+	sep    rune   // 当前层级用于分割子表达式的连接符，'|'或者'&'
+	quoted bool   // 是否识别双引号括起来的短语，短语内的字符都不作为语法符号
+}
+
+// 提取下一个子表达式
+func (s *subExpScanner) next() (*SubExp, *CstError) {
+	subExp := SubExp{
+		IsNegative:   false,
+		Exp:          make([]rune, 0, len(s.orgExp)),
+		IsMeta:       true,
+		BracketStack: make([]int, len(s.orgExp)),
+	}
+	bsIdx := 0 // bracketStack的浮标
+	for i := s.iter; i < len(s.orgExp); i++ {
+		c := s.orgExp[i]
+		if s.quoted && c == '"' {
+			end := skipPhrase(s.orgExp, i)
+			subExp.Exp = append(subExp.Exp, s.orgExp[i:end]...)
+			i = end - 1
+			continue
+		}
+		switch c {
+		case rune('('):
+			subExp.BracketStack[bsIdx] = len(subExp.Exp) // 记录左括号在子表达式里的下标
+			bsIdx++
+			subExp.Exp = append(subExp.Exp, c)
+		case rune(')'):
+			bsIdx--
+			if bsIdx < 0 { // 括号不匹配
+				return nil, newCstError(ErrCodeInvalidExpression, "invalid expression: %v", string(s.orgExp))
+			}
+			subExp.Exp = append(subExp.Exp, c)
+		case rune('|'), rune('&'):
+			if c == s.sep && bsIdx == 0 {
+				s.iter = i + 1
+				return &subExp, nil
+			}
+			// 括号内的连接符，或者非当前层级的连接符，不能作为当前层级分割子表达式的标识
+			subExp.Exp = append(subExp.Exp, c)
+			subExp.IsMeta = false
+		default:
+			subExp.Exp = append(subExp.Exp, c)
+		}
+	}
+	if bsIdx > 0 { // 子表达式里，括号不配对
+		return nil, newCstError(ErrCodeInvalidExpression, "invalid expression: %v", string(subExp.Exp))
+	}
+	s.iter = len(s.orgExp)
+	return &subExp, nil
+}
+
+/*
+ * 编译后的逻辑表达式
+ * LogExp是只读的，Match可以被多个goroutine并发调用
+ */
 type LogExp struct {
 	expression IExpression
+	fold       Fold     // 匹配前对文本做的规范化，跟编译时对关键词做的一致
+	program    *program // 表达式树编译成的指令序列，Match通过它求值
+}
+
+func newLogExp(expression IExpression, fold Fold) *LogExp {
+	return &LogExp{
+		expression: expression,
+		fold:       fold,
+		program:    compileProgram(expression),
+	}
 }
 
+/*
+ * 判断表达式是否匹配给定的文本，不分配内存；有两个例外：
+ * 时间表达式指定了默认格式以外的TimeOptions.Layouts时，用time.Parse解析时间戳，可能分配内存；
+ * 指定了Fold时，规范化缓冲区超过maxPooledFoldBuffer的长文本不放回缓冲池，每次匹配都会重新分配
+ */
 func (e *LogExp) Match(text string) bool {
-	return e.expression.Match(text)
+	if e.fold == 0 {
+		return e.program.match(text)
+	}
+	buf := foldPool.Get().(*foldBuffer)
+	res := e.program.match(buf.fold(text, e.fold))
+	buf.release()
+	return res
+}
+
+// 返回编译后的表达式树，表达式树是只读的
+func (e *LogExp) GetExpression() IExpression {
+	return e.expression
+}
+
+func (e *LogExp) String() string {
+	return expressionString(e.expression)
 }
 
 func (e *LogExp) ToJson() string {
@@ -93,9 +237,31 @@ func (e *LogExp) ToJson() string {
 }
 
 func Compile(exp string) (*LogExp, *CstError) {
-	expression, cerr := NewExpressionOr([]rune(exp), false, 0)
+	return CompileWithOptions(exp, CompileOptions{})
+}
+
+func CompileWithOptions(exp string, opts CompileOptions) (*LogExp, *CstError) {
+	runes := []rune(exp)
+	if opts.MaxLength > 0 && len(runes) > opts.MaxLength {
+		return nil, newCstError(ErrCodeTooLong, "expression is longer than %v characters", opts.MaxLength)
+	}
+	p := parser{opts: opts}
+	expression, cerr := p.compile(string(runes))
 	if cerr != nil {
 		return nil, cerr
 	}
-	return &LogExp{expression: expression}, nil
+	return newLogExp(expression, opts.Fold), nil
+}
+
+// 跟Compile相同，编译失败时以*CstError panic；用于编译程序中写死的表达式
+func MustCompile(exp string) *LogExp {
+	return MustCompileWithOptions(exp, CompileOptions{})
+}
+
+func MustCompileWithOptions(exp string, opts CompileOptions) *LogExp {
+	expression, cerr := CompileWithOptions(exp, opts)
+	if cerr != nil {
+		panic(cerr)
+	}
+	return expression
 }
@@ -1,8 +1,16 @@
 package logexp
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -200,6 +208,1334 @@ func TestMatch(t *testing.T) {
 	}
 }
 
+func TestMatchContext(t *testing.T) {
+	expression, cerr := Compile("(!(hello&!we)|hi)&wow")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	for _, text := range []string{"hello world", "we hello world wow", "hi wow", ""} {
+		hit, err := expression.MatchContext(context.Background(), text)
+		assert.Nil(t, err)
+		assert.Equal(t, expression.Match(text), hit, text)
+	}
+
+	// 跨越扫描块边界的关键词
+	long := strings.Repeat("x", scanChunkSize-2) + "wow hi" + strings.Repeat("y", scanChunkSize)
+	hit, err := expression.MatchContext(context.Background(), long)
+	assert.Nil(t, err)
+	assert.True(t, hit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = expression.MatchContext(ctx, long)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestCompileLimits(t *testing.T) {
+	type Case struct {
+		Exp  string
+		Opts CompileOptions
+		Code int // 0表示编译成功
+	}
+	testCases := []Case{
+		{Exp: "hello|hi", Opts: CompileOptions{MaxLength: 8}, Code: 0},
+		{Exp: "hello|hi", Opts: CompileOptions{MaxLength: 7}, Code: ErrCodeTooLong},
+		{Exp: "中国|深圳", Opts: CompileOptions{MaxLength: 5}, Code: 0},
+		{Exp: "((a|b)&c)|d", Opts: CompileOptions{MaxDepth: 3}, Code: 0},
+		{Exp: "((a|b)&c)|d", Opts: CompileOptions{MaxDepth: 2}, Code: ErrCodeTooDeep},
+		{Exp: "((((((((a|b)&c)|d)&e)|f)&g)|h)&i)", Opts: CompileOptions{MaxDepth: 4}, Code: ErrCodeTooDeep},
+		{Exp: "a|b|c&d", Opts: CompileOptions{MaxKeywords: 4}, Code: 0},
+		{Exp: "a|b|c&d", Opts: CompileOptions{MaxKeywords: 3}, Code: ErrCodeTooManyKeywords},
+		{Exp: "a|b|c&d", Opts: CompileOptions{MaxNodes: 3}, Code: ErrCodeTooManyNodes},
+		{Exp: "a|b|c&d", Opts: CompileOptions{MaxNodes: 100}, Code: 0},
+		{Exp: "a|(b", Opts: CompileOptions{MaxNodes: 100}, Code: ErrCodeInvalidExpression},
+	}
+	for idx, cas := range testCases {
+		_, cerr := CompileWithOptions(cas.Exp, cas.Opts)
+		if cas.Code == 0 {
+			assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		} else if assert.NotEqual(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp)) {
+			assert.Equal(t, cas.Code, cerr.Code, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		}
+	}
+}
+
+func TestSyntax(t *testing.T) {
+	type Case struct {
+		Exp    string
+		Syntax Syntax
+		Same   string // 基础语法下等价的表达式
+	}
+	all := Syntax_WordOperators | Syntax_DoubledSymbols | Syntax_PrefixModifiers
+	testCases := []Case{
+		{Exp: "error AND NOT timeout", Syntax: 0, Same: "error AND NOT timeout"},
+		{Exp: "error AND NOT timeout", Syntax: Syntax_WordOperators, Same: "error&!timeout"},
+		{Exp: "(error or warn) and not  timeout", Syntax: Syntax_WordOperators, Same: "(error|warn)&!timeout"},
+		{Exp: "error NOT timeout", Syntax: Syntax_WordOperators, Same: "error&!timeout"},
+		{Exp: "NOT(a|b) OR android", Syntax: Syntax_WordOperators, Same: "!(a|b)|android"},
+		{Exp: "out of memory OR oom", Syntax: Syntax_WordOperators, Same: "out of memory|oom"},
+		{Exp: "error && !timeout", Syntax: Syntax_DoubledSymbols, Same: "error&!timeout"},
+		{Exp: "a||b&c", Syntax: Syntax_DoubledSymbols, Same: "a|b&c"},
+		{Exp: "error -timeout +db", Syntax: Syntax_PrefixModifiers, Same: "error&!timeout&db"},
+		{Exp: "-(a|b)&time-out", Syntax: Syntax_PrefixModifiers, Same: "!(a|b)&time-out"},
+		{Exp: "a - b", Syntax: Syntax_PrefixModifiers, Same: "a - b"},
+		{Exp: "error && (warn OR fatal) -timeout", Syntax: all, Same: "error&(warn|fatal)&!timeout"},
+		{Exp: "hello world", Syntax: 0, Same: "hello world"},
+		{Exp: "hello world", Syntax: Syntax_ImplicitAnd, Same: "hello&world"},
+		{Exp: " a | b  c ", Syntax: Syntax_ImplicitAnd, Same: "a|b&c"},
+		{Exp: "( a|b ) !c (d)", Syntax: Syntax_ImplicitAnd, Same: "(a|b)&!c&d"},
+		{Exp: `payment "time out" | "空 格"`, Syntax: Syntax_ImplicitAnd, Same: "payment&time out|空 格"},
+		{Exp: "error AND NOT timeout", Syntax: Syntax_ImplicitAnd | Syntax_WordOperators, Same: "error&!timeout"},
+		{Exp: "error -timeout db", Syntax: Syntax_ImplicitAnd | Syntax_PrefixModifiers, Same: "error&!timeout&db"},
+		{Exp: "（支付｜退款）＆！超时", Syntax: Syntax_FullWidth, Same: "(支付|退款)&!超时"},
+		{Exp: "支付 ＆ “超 时｜”", Syntax: Syntax_FullWidth | Syntax_ImplicitAnd, Same: "支付&超 时｜"},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, CompileOptions{Syntax: cas.Syntax})
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		same, cerr := Compile(cas.Same)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Same))
+		assert.Equal(t, same.ToJson(), expression.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	type Case struct {
+		Exp    string
+		Opts   CompileOptions
+		String string
+	}
+	testCases := []Case{
+		// 基础语法里引号是普通字符，关键词按原样输出
+		{Exp: `say "hi"`, String: `say "hi"`},
+		{Exp: `a"b|"c d"`, String: `a"b|"c d"`},
+		{Exp: "ａ&ｂ c", Opts: CompileOptions{Fold: Fold_NFKC}, String: "a&b c"},
+		{Exp: `^"x"&y z$`, Opts: CompileOptions{Syntax: Syntax_Anchors}, String: `^"x"&y z$`},
+		{Exp: `"ab"~1`, Opts: CompileOptions{Syntax: Syntax_Fuzzy}, String: `"ab"~1`},
+		{Exp: "zhifu shibai", Opts: CompileOptions{Pinyin: PinyinMode_Full}, String: "zhifu shibai"},
+		// 短语语法里，含有语法符号、引号或者空白的关键词写成短语
+		{Exp: `"say \"hi\"" "time out"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd}, String: `"say \"hi\""&"time out"`},
+		{Exp: `"zhifu shibai" | ^"a b"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_Anchors, Pinyin: PinyinMode_Full}, String: `"zhifu shibai"|^"a b"`},
+		{Exp: `"time out"~1`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_Fuzzy}, String: `"time out"~1`},
+		// 短语语法里，按原样输出会被当成其他写法的关键词也写成短语
+		{Exp: `"-v" "+v"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_PrefixModifiers}, String: `"-v"&"+v"`},
+		{Exp: `"abc~1"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_Fuzzy}, String: `"abc~1"`},
+		{Exp: `"^GET" "GET$" "=GET"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_Anchors}, String: `"^GET"&"GET$"&"=GET"`},
+		{Exp: `"status>500" "latency:[1" status=503`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_Compare}, String: `"status>500"&"latency:[1"&status=503`},
+		{Exp: `"@time>=2026-10-01"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_Time}, String: `"@time>=2026-10-01"`},
+		{Exp: `"and" | "NOT" | "order"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_WordOperators}, String: `"and"|"NOT"|order`},
+		{Exp: `"@db"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd, Registry: NewRegistry()}, String: `"@db"`},
+		{Exp: `"{name}"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd}, String: `"{name}"`},
+		{Exp: `"a\“b" "c｜d"`, Opts: CompileOptions{Syntax: Syntax_ImplicitAnd | Syntax_FullWidth}, String: `"a\“b"&"c｜d"`},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, cas.Opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.String, expression.String(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		again, cerr := CompileWithOptions(expression.String(), cas.Opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, expression.ToJson(), again.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+
+	// 基础语法里，规范化或者同义词带来的语法符号无法写成文本形式，编译失败
+	for _, opts := range []CompileOptions{
+		{Fold: Fold_NFKC},
+		{Synonyms: Synonyms{"ａ｜ｂ": {"a|b"}}},
+	} {
+		_, cerr := CompileWithOptions("ａ｜ｂ", opts)
+		assert.Equal(t, ErrCodeInvalidExpression, cerr.Code)
+	}
+	expression, cerr := CompileWithOptions("ａ｜ｂ", CompileOptions{Fold: Fold_NFKC, Syntax: Syntax_ImplicitAnd})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, `"a|b"`, expression.String())
+	assert.Equal(t, true, expression.Match("ａ｜ｂ"))
+}
+
+func TestPhrase(t *testing.T) {
+	opts := CompileOptions{Syntax: Syntax_ImplicitAnd}
+	type Case struct {
+		Exp          string
+		Valid        bool
+		CompiledJson string
+	}
+	testCases := []Case{
+		{
+			Exp:          `"a | b" !"(c)"`,
+			Valid:        true,
+			CompiledJson: `{"type":2,"is_negative":false,"expressions":[{"type":0,"is_negative":false,"keyword":"a | b"},{"type":0,"is_negative":true,"keyword":"(c)"}]}`,
+		},
+		{
+			Exp:          `"say \"hi\""`,
+			Valid:        true,
+			CompiledJson: `{"type":0,"is_negative":false,"keyword":"say \"hi\""}`,
+		},
+		{Exp: `"unclosed`, Valid: false},
+		{Exp: `""`, Valid: false},
+		{Exp: `ab"cd"`, Valid: false},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, opts)
+		if !cas.Valid {
+			assert.NotEqual(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+			continue
+		}
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.CompiledJson, expression.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		// 文本形式可以重新编译成同样的表达式
+		again, cerr := CompileWithOptions(expression.String(), opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, expression.String()))
+		assert.Equal(t, cas.CompiledJson, again.ToJson(), fmt.Sprintf("case %v: %v", idx, expression.String()))
+	}
+}
+
+func TestLint(t *testing.T) {
+	expression, cerr := Compile("（支付｜退款）&超时")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	warnings := expression.Lint()
+	if assert.Equal(t, 1, len(warnings)) {
+		assert.Equal(t, "（支付｜退款）", warnings[0].Keyword)
+	}
+
+	expression, cerr = CompileWithOptions("（支付｜退款）&超时", CompileOptions{Syntax: Syntax_FullWidth})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, 0, len(expression.Lint()))
+}
+
+func TestFoldNFKC(t *testing.T) {
+	type Case struct {
+		Exp   string
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "ｈｅｌｌｏ", Text: "hello world", Match: true},
+		{Exp: "hello", Text: "ｈｅｌｌｏ ｗｏｒｌｄ", Match: true},
+		{Exp: "café", Text: "cafe\u0301 au lait", Match: true},
+		{Exp: "cafe\u0301", Text: "café au lait", Match: true},
+		{Exp: "file", Text: "\ufb01le not found", Match: true},
+		{Exp: "ガス", Text: "ｶﾞｽ", Match: true},
+		{Exp: "error 503", Text: "error\u3000５０３", Match: true},
+		{Exp: "한국", Text: "\u1112\u1161\u11ab\u1100\u116e\u11a8", Match: true},
+		{Exp: "cafe", Text: "café", Match: false},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, CompileOptions{Fold: Fold_NFKC})
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+}
+
+func TestFoldChineseVariant(t *testing.T) {
+	type Case struct {
+		Exp   string
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "支付失败&连接超时", Text: "支付失敗：連接超時", Match: true},
+		{Exp: "資料庫錯誤", Text: "资料库错误 code=1045", Match: true},
+		{Exp: "发送|头发", Text: "頭髮", Match: true},
+		{Exp: "订单&!退款", Text: "訂單已退款", Match: false},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, CompileOptions{Fold: Fold_ChineseVariant})
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+}
+
+func TestPinyin(t *testing.T) {
+	type Case struct {
+		Exp   string
+		Mode  PinyinMode
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "zhifu shibai", Mode: PinyinMode_Full, Text: "订单123支付失败", Match: true},
+		{Exp: "zfsb", Mode: PinyinMode_Initials, Text: "订单123支付失败", Match: true},
+		{Exp: "zhfsb", Mode: PinyinMode_Initials, Text: "支付失败", Match: true},
+		{Exp: "zfsb", Mode: PinyinMode_Full, Text: "支付失败", Match: false},
+		{Exp: "zhif sb", Mode: PinyinMode_Full | PinyinMode_Initials, Text: "支付失败", Match: true},
+		{Exp: "ZhiFu&!tuikuan", Mode: PinyinMode_Full, Text: "支付成功，未退款", Match: false},
+		{Exp: "lvse", Mode: PinyinMode_Full, Text: "绿色", Match: true},
+		{Exp: "lu se", Mode: PinyinMode_Full, Text: "绿色", Match: true},
+		{Exp: "zhifu", Mode: PinyinMode_Full, Text: "支付失敗", Match: true},
+		{Exp: "zhifu", Mode: PinyinMode_Full, Text: "zhifu timeout", Match: true},
+		{Exp: "zhifubao", Mode: PinyinMode_Full, Text: "支付bao", Match: true},
+		{Exp: "zhifu", Mode: 0, Text: "支付失败", Match: false},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, CompileOptions{Pinyin: cas.Mode})
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Exp, expression.String(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	type Case struct {
+		Exp   string
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "paymnet~1", Text: "payment failed", Match: true},
+		{Exp: "paymnet~1", Text: "paymet failed", Match: true},
+		{Exp: "payment~1", Text: "pyamnet failed", Match: false},
+		{Exp: "payment~2", Text: "pyamnet failed", Match: true},
+		{Exp: "payment~0", Text: "paymnet failed", Match: false},
+		{Exp: "timeout~1&!paymnet~1", Text: "payment timeuot", Match: false},
+		{Exp: "支付失败~1", Text: "支付夫败", Match: true},
+		{Exp: "\"time out\"~1", Text: "timeout", Match: true},
+		{Exp: "a~b", Text: "a~b", Match: true},
+	}
+	opts := CompileOptions{Syntax: Syntax_Fuzzy | Syntax_ImplicitAnd}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		// 文本形式用同样的选项可以重新编译，含有空白的关键词写成短语
+		again, cerr := CompileWithOptions(expression.String(), opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, expression.ToJson(), again.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+	for _, exp := range []string{"ab~2", "a~1"} {
+		_, cerr := CompileWithOptions(exp, opts)
+		assert.NotEqual(t, (*CstError)(nil), cerr, exp)
+	}
+
+	// 位并行算法的结果跟逐个子串计算编辑距离的结果一致
+	rnd := rand.New(rand.NewSource(1))
+	randString := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+	for i := 0; i < 2000; i++ {
+		keyword, text := randString(2+rnd.Intn(6)), randString(rnd.Intn(12))
+		distance := 1 + rnd.Intn(len(keyword)-1)
+		expect := false
+		for start := 0; start <= len(text) && !expect; start++ {
+			for end := start; end <= len(text); end++ {
+				if editDistance([]rune(keyword), []rune(text[start:end])) <= distance {
+					expect = true
+					break
+				}
+			}
+		}
+		exp := &ExpressionFuzzy{Type: ExpressionType_Fuzzy, Keyword: keyword, Distance: distance}
+		assert.Equal(t, expect, exp.Match(text), fmt.Sprintf("%v~%v in %v", keyword, distance, text))
+	}
+}
+
+func TestCompare(t *testing.T) {
+	type Case struct {
+		Exp   string
+		Fold  Fold
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "latency>500", Text: "GET /pay latency=532ms status=200", Match: true},
+		{Exp: "latency>500", Text: "GET /pay latency=500ms status=200", Match: false},
+		{Exp: "latency>=500", Text: "GET /pay latency=500ms status=200", Match: true},
+		{Exp: "latency<1.5", Text: "latency: 1.25s", Match: true},
+		{Exp: "status:[500 TO 599]", Text: "GET /pay status=503", Match: true},
+		{Exp: "status:[500 TO 599}", Text: "GET /pay status=599", Match: false},
+		{Exp: "status:[500 TO *]", Text: `{"path":"/pay","status": "503"}`, Match: true},
+		{Exp: "status:[500 TO 599]", Text: "http_status=503 status=200", Match: false},
+		{Exp: "status:[500 TO 599]", Text: "status=200 retry status=502", Match: true},
+		{Exp: "支付&!cost<0", Text: "支付 cost=-1", Match: false},
+		{Exp: "a->b", Text: "a->b", Match: true},
+		// 规范化只作用于键，区间的写法按原样解析
+		{Exp: "Status:[500 TO 599]", Fold: Fold_Case, Text: "GET /pay STATUS=503", Match: true},
+		{Exp: "Latency>500", Fold: Fold_Case, Text: "LATENCY=532ms", Match: true},
+		{Exp: "ｓｔａｔｕｓ:{500 TO *]", Fold: Fold_NFKC, Text: "status=500", Match: false},
+	}
+	for idx, cas := range testCases {
+		opts := CompileOptions{Syntax: Syntax_Compare, Fold: cas.Fold}
+		expression, cerr := CompileWithOptions(cas.Exp, opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		again, cerr := CompileWithOptions(expression.String(), opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, expression.ToJson(), again.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+	for _, exp := range []string{"status:[500 599]", "status:[a TO 599]", "status:[500 TO 599"} {
+		_, cerr := CompileWithOptions(exp, CompileOptions{Syntax: Syntax_Compare})
+		assert.NotEqual(t, (*CstError)(nil), cerr, exp)
+	}
+
+	// 搜索引擎风格的语法下，区间内的空白不分隔词
+	expression, cerr := CompileWithOptions("pay status:[500 TO 599]", CompileOptions{Syntax: Syntax_Compare | Syntax_ImplicitAnd})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "pay&status:[500 TO 599]", expression.String())
+	assert.Equal(t, "[hit]  pay&status:[500 TO 599]\n"+
+		"  [hit]  pay (found at offset 0)\n"+
+		"  [hit]  status:[500 TO 599] (status=503 at offset 10 is in range)\n", expression.Explain("pay retry status=503").String())
+}
+
+func TestTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	type Case struct {
+		Exp   string
+		Opts  TimeOptions
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "@time>=2026-10-01T00:00:00Z", Text: "2026-10-19T11:50:00.123Z ERROR payment failed", Match: true},
+		{Exp: "@time>=2026-10-01T00:00:00Z", Text: "2026-09-30T23:59:59Z ERROR payment failed", Match: false},
+		{Exp: "@time<2026-10-01", Text: "[2026-09-30 23:59:59] ERROR", Match: true},
+		{Exp: "@time:[2026-10-01T00:00:00Z TO 2026-10-02T00:00:00Z}", Text: "2026-10-02 00:00:00 ERROR", Match: false},
+		{Exp: "@time in last 15m", Text: "2026-10-19T11:50:00Z ERROR", Match: true},
+		{Exp: "@time in last 15m", Text: "2026-10-19T11:40:00Z ERROR", Match: false},
+		{Exp: "@time in last 15m", Text: "ERROR without timestamp", Match: false},
+		{Exp: "ERROR&@time in last 1d", Text: "2026-10-18 12:00:00 ERROR", Match: true},
+		{Exp: "@time in last 1h", Opts: TimeOptions{Field: "ts"}, Text: `{"msg":"retry at 2026-10-19 11:30:00","ts":"2026-10-19T10:30:00Z"}`, Match: false},
+		{Exp: "@time in last 1h", Opts: TimeOptions{Field: "ts"}, Text: "msg=ok ts=1792410000", Match: true},
+		{Exp: "@time>=2026-10-19T20:00:00+08:00", Opts: TimeOptions{Location: time.FixedZone("CST", 8*3600)}, Text: "2026/10/19 20:00:00 ok", Match: true},
+		{Exp: "@time<2026-10-01", Opts: TimeOptions{Layouts: DefaultTimeLayouts}, Text: "[2026-09-30 23:59:59] ERROR", Match: true},
+		{Exp: "@time<2026-10-01", Opts: TimeOptions{Layouts: DefaultTimeLayouts}, Text: "2026/09/30T23:59:59+0800 ERROR", Match: true},
+		{Exp: "@time<2026-10-01", Opts: TimeOptions{Layouts: []string{"2006-01-02 15:04:05"}}, Text: "2026/09/30T23:59:59+0800 ERROR", Match: false},
+		{Exp: "@time>2026-10-19T12:00:00Z", Opts: TimeOptions{Layouts: []string{"02/Jan/2006:15:04:05 -0700"}}, Text: `1.2.3.4 - - [19/Oct/2026:20:00:01 +0800] "GET /"`, Match: true},
+		{Exp: "@time in last 15m", Text: "2026-10-19T19:50:00.5+08:00 ERROR", Match: true},
+		{Exp: "@time in last 15m", Text: "2026-10-19T11:50:00-0130 ERROR", Match: false},
+		{Exp: "@time in last 15m", Text: "2026-02-30 11:50:00 ERROR", Match: false},
+		{Exp: "@time in last 15m", Text: "2026-10-19 11:50:00abc ERROR", Match: false},
+		{Exp: "@timeout", Text: "@timeout", Match: true},
+	}
+	for idx, cas := range testCases {
+		cas.Opts.Now = func() time.Time { return now }
+		opts := CompileOptions{Syntax: Syntax_Time, Time: cas.Opts}
+		expression, cerr := CompileWithOptions(cas.Exp, opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		again, cerr := CompileWithOptions(expression.String(), opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, expression.ToJson(), again.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+	for _, exp := range []string{"@time>yesterday", "@time in last 0m", "@time:[* TO soon]"} {
+		_, cerr := CompileWithOptions(exp, CompileOptions{Syntax: Syntax_Time})
+		assert.NotEqual(t, (*CstError)(nil), cerr, exp)
+	}
+
+	// 搜索引擎风格的语法下，相对时间窗口内的空白不分隔词
+	expression, cerr := CompileWithOptions("payment @time in last 15m", CompileOptions{
+		Syntax: Syntax_Time | Syntax_ImplicitAnd,
+		Time:   TimeOptions{Now: func() time.Time { return now }},
+	})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "payment&@time in last 15m", expression.String())
+	assert.Equal(t, true, expression.Match("2026-10-19T11:59:00Z payment failed"))
+}
+
+func TestAnchor(t *testing.T) {
+	type Case struct {
+		Exp   string
+		Text  string
+		Match bool
+	}
+	testCases := []Case{
+		{Exp: "^GET", Text: "GET /api/orders.json 200", Match: true},
+		{Exp: "^GET", Text: "POST /api/GET 200", Match: false},
+		{Exp: ".json$", Text: "/static/app.json", Match: true},
+		{Exp: ".json$", Text: "/static/app.json.bak", Match: false},
+		{Exp: "=done", Text: "step 1\r\ndone\r\n", Match: true},
+		{Exp: "=done", Text: "done.", Match: false},
+		{Exp: "^/api/$", Text: "/api/", Match: true},
+		{Exp: "^GET&!.json$", Text: "GET /a.json", Match: false},
+		{Exp: "^", Text: "a^b", Match: true},
+		{Exp: "price$5", Text: "price$5", Match: true},
+	}
+	opts := CompileOptions{Syntax: Syntax_Anchors}
+	for idx, cas := range testCases {
+		expression, cerr := CompileWithOptions(cas.Exp, opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Match, expression.Match(cas.Text), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		again, cerr := CompileWithOptions(expression.String(), opts)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, expression.ToJson(), again.ToJson(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+
+	// 短语也可以锚定
+	expression, cerr := CompileWithOptions(`^"GET /api" .json$`, CompileOptions{Syntax: Syntax_Anchors | Syntax_ImplicitAnd})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, `{"type":2,"is_negative":false,"expressions":[{"type":7,"is_negative":false,"keyword":"GET /api","anchor":1},{"type":7,"is_negative":false,"keyword":".json","anchor":2}]}`, expression.ToJson())
+	assert.Equal(t, true, expression.Match("GET /api/orders.json"))
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	assert.Equal(t, (*CstError)(nil), registry.Define("db_errors", "deadlock|lock wait|@conn_errors"))
+	assert.Equal(t, (*CstError)(nil), registry.Define("conn_errors", "too many connections|connection refused"))
+	payment, cerr := Compile("payment&!retry")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, (*CstError)(nil), registry.DefineExpression("payment", payment.GetExpression()))
+	assert.NotEqual(t, (*CstError)(nil), registry.Define("bad name", "a"))
+	assert.Equal(t, []string{"conn_errors", "db_errors", "payment"}, registry.Names())
+
+	opts := CompileOptions{Registry: registry}
+	expression, cerr := CompileWithOptions("@payment&(@db_errors|timeout)", opts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "payment&!retry&(deadlock|lock wait|too many connections|connection refused|timeout)", expression.String())
+	assert.Equal(t, true, expression.Match("payment failed: too many connections"))
+	assert.Equal(t, false, expression.Match("payment retry: deadlock"))
+
+	expression, cerr = CompileWithOptions("error&!@db_errors", opts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "error&!(deadlock|lock wait|too many connections|connection refused)", expression.String())
+
+	_, cerr = CompileWithOptions("@unknown|error", opts)
+	assert.Equal(t, ErrCodeUndefinedName, cerr.Code)
+
+	assert.Equal(t, (*CstError)(nil), registry.Define("a", "x|@b"))
+	assert.Equal(t, (*CstError)(nil), registry.Define("b", "y&@a"))
+	_, cerr = CompileWithOptions("@a", opts)
+	assert.Equal(t, ErrCodeCircularDefinition, cerr.Code)
+	assert.Equal(t, true, strings.Contains(cerr.Message, "@a -> @b -> @a"))
+
+	// 编译好的定义按引用方的Fold重新规范化
+	upper, cerr := Compile("ERROR&!Debug")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, (*CstError)(nil), registry.DefineExpression("err", upper.GetExpression()))
+	expression, cerr = CompileWithOptions("@err", CompileOptions{Registry: registry, Fold: Fold_Case})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, expression.Match("error happened"))
+	assert.Equal(t, false, expression.Match("debug: error happened"))
+	expression, cerr = CompileWithOptions("@err", opts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, false, expression.Match("error happened"))
+	assert.Equal(t, true, expression.Match("ERROR happened"))
+	// 比较表达式的键和拼音关键词同样重新规范化
+	mixed, cerr := CompileWithOptions("Latency>500|ZhiFu&!PAY", CompileOptions{Syntax: Syntax_Compare, Pinyin: PinyinMode_Full})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, (*CstError)(nil), registry.DefineExpression("mixed", mixed.GetExpression()))
+	expression, cerr = CompileWithOptions("@mixed", CompileOptions{Registry: registry, Fold: Fold_Case})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "latency>500|(zhifu&!pay)", expression.String())
+	assert.Equal(t, true, expression.Match("LATENCY=800ms"))
+	assert.Equal(t, false, expression.Match("latency=300ms"))
+	assert.Equal(t, true, expression.Match("ZHIFU failed"))
+	assert.Equal(t, true, expression.Match("支付失败"))
+	assert.Equal(t, false, expression.Match("zhifu pay"))
+	// 规范化之后不再是合法的键时编译失败
+	bad, cerr := CompileWithOptions("Ŀatency>500", CompileOptions{Syntax: Syntax_Compare})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, (*CstError)(nil), registry.DefineExpression("bad_key", bad.GetExpression()))
+	_, cerr = CompileWithOptions("@bad_key", CompileOptions{Registry: registry, Fold: Fold_NFKC})
+	assert.Equal(t, ErrCodeInvalidExpression, cerr.Code)
+
+	// 定义跟写在括号里一样计入上限，层层引用的定义展开后的大小是指数级的
+	chain := NewRegistry()
+	assert.Equal(t, (*CstError)(nil), chain.Define("d0", "x0"))
+	for i := 1; i <= 22; i++ {
+		assert.Equal(t, (*CstError)(nil), chain.Define(fmt.Sprintf("d%v", i), fmt.Sprintf("(@d%v|x%v)&(@d%v|y%v)", i-1, i, i-1, i)))
+	}
+	limited := CompileOptions{Registry: chain, MaxDepth: 3, MaxNodes: 1000, MaxKeywords: 100}
+	_, cerr = CompileWithOptions("@d22", limited)
+	assert.NotEqual(t, (*CstError)(nil), cerr)
+	_, cerr = CompileWithOptions("@d22", CompileOptions{Registry: chain, MaxNodes: 1000})
+	assert.Equal(t, ErrCodeTooManyNodes, cerr.Code)
+	_, cerr = CompileWithOptions("@d22", CompileOptions{Registry: chain, MaxKeywords: 100})
+	assert.Equal(t, ErrCodeTooManyKeywords, cerr.Code)
+	_, cerr = CompileWithOptions("@d22", CompileOptions{Registry: chain, MaxDepth: 3})
+	assert.Equal(t, ErrCodeTooDeep, cerr.Code)
+	_, cerr = CompileWithOptions("@d1", CompileOptions{Registry: chain, MaxLength: 10})
+	assert.Equal(t, ErrCodeTooLong, cerr.Code)
+	// 展开后在上限之内的引用不受影响
+	expression, cerr = CompileWithOptions("@d2", CompileOptions{Registry: chain, MaxNodes: 1000, MaxKeywords: 100})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, expression.Match("x0 y2"))
+
+	// 没有注册表时，@name是普通的关键词
+	expression, cerr = Compile("@payment")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, expression.Match("@payment"))
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, cerr := CompileTemplate("{service}&(error|fatal)&!{ignore}")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, []string{"ignore", "service"}, tmpl.Placeholders())
+	assert.Equal(t, "{service}&(error|fatal)&!{ignore}", tmpl.String())
+
+	pay, cerr := tmpl.Instantiate(map[string]string{"service": "payment", "ignore": "healthcheck"})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "payment&(error|fatal)&!healthcheck", pay.String())
+	assert.Equal(t, true, pay.Match("payment error"))
+	assert.Equal(t, false, pay.Match("payment healthcheck error"))
+
+	// 不含占位符的子树在实例之间共用
+	other, cerr := tmpl.Instantiate(map[string]string{"service": "order", "ignore": "x"})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, pay.GetExpression().GetExps()[1] == other.GetExpression().GetExps()[1])
+
+	// 值里的语法符号按原样作为关键词，不需要转义，文本形式写成短语
+	rd, cerr := tmpl.Instantiate(map[string]string{"service": "R&D", "ignore": "x"})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, `"R&D"&(error|fatal)&!x`, rd.String())
+	assert.Equal(t, true, rd.Match("R&D fatal"))
+	assert.Equal(t, false, rd.Match("R fatal"))
+	again, cerr := CompileWithOptions(rd.String(), CompileOptions{Syntax: Syntax_ImplicitAnd})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, again.Match("R&D fatal"))
+	phraseOpts := CompileOptions{Syntax: Syntax_ImplicitAnd}
+	phraseTmpl, cerr := CompileTemplateWithOptions("{service}&(error|fatal)&!{ignore}", phraseOpts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	odd, cerr := phraseTmpl.Instantiate(map[string]string{"service": "a|b&!(c)", "ignore": "x y"})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, `"a|b&!(c)"&(error|fatal)&!"x y"`, odd.String())
+	assert.Equal(t, true, odd.Match("a|b&!(c) fatal"))
+	assert.Equal(t, false, odd.Match("a fatal"))
+	again, cerr = CompileWithOptions(odd.String(), phraseOpts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, odd.ToJson(), again.ToJson())
+
+	_, cerr = tmpl.Instantiate(map[string]string{"service": "payment"})
+	assert.Equal(t, ErrCodeMissingValue, cerr.Code)
+
+	// 普通的编译不识别占位符
+	expression, cerr := Compile("{service}")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, expression.Match("{service}"))
+}
+
+func TestSynonyms(t *testing.T) {
+	synonyms, cerr := ParseSynonyms(`
+# 内存
+oom => out of memory, OutOfMemoryError
+timeout, timed out, 超时
+`)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, []string{"timed out", "超时"}, synonyms["timeout"])
+	assert.Equal(t, []string(nil), synonyms["out of memory"])
+	_, cerr = ParseSynonyms("lonely")
+	assert.NotEqual(t, (*CstError)(nil), cerr)
+
+	opts := CompileOptions{Synonyms: synonyms}
+	expression, cerr := CompileWithOptions("oom&!timeout", opts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "(oom|out of memory|OutOfMemoryError)&!(timeout|timed out|超时)", expression.String())
+	assert.Equal(t, `{"type":2,"is_negative":false,"expressions":[{"type":1,"is_negative":false,"expressions":[{"type":0,"is_negative":false,"keyword":"oom"},{"type":0,"is_negative":false,"keyword":"out of memory"},{"type":0,"is_negative":false,"keyword":"OutOfMemoryError"}]},{"type":1,"is_negative":true,"expressions":[{"type":0,"is_negative":false,"keyword":"timeout"},{"type":0,"is_negative":false,"keyword":"timed out"},{"type":0,"is_negative":false,"keyword":"超时"}]}]}`, expression.ToJson())
+	assert.Equal(t, true, expression.Match("java.lang.OutOfMemoryError: heap"))
+	assert.Equal(t, false, expression.Match("out of memory, request 超时"))
+	assert.Equal(t, "[hit]  (oom|out of memory|OutOfMemoryError)&!(timeout|timed out|超时)\n"+
+		"  [hit]  oom|out of memory|OutOfMemoryError\n"+
+		"    [miss] oom (not found)\n"+
+		"    [miss] out of memory (not found)\n"+
+		"    [hit]  OutOfMemoryError (found at offset 10)\n"+
+		"  [hit]  !(timeout|timed out|超时)\n"+
+		"    [miss] timeout (not found)\n"+
+		"    [miss] timed out (not found)\n"+
+		"    [miss] 超时 (not found)\n", expression.Explain("java.lang.OutOfMemoryError: heap").String())
+
+	// 模板实例化的值同样被展开
+	tmpl, cerr := CompileTemplateWithOptions("{reason}|fatal", opts)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	expression, cerr = tmpl.Instantiate(map[string]string{"reason": "oom"})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "oom|out of memory|OutOfMemoryError|fatal", expression.String())
+}
+
+func TestOptimize(t *testing.T) {
+	corpus := []string{
+		"INFO payment ok",
+		"ERROR payment failed: timeout",
+		"ERROR order failed: timeout",
+		"ERROR order failed: deadlock",
+		"INFO order ok",
+		"ERROR payment failed: timeout",
+	}
+	expression, cerr := Compile("ERROR&(timeout|deadlock)&!INFO&deadlock")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	stats := NewStats()
+	for _, text := range corpus {
+		stats.Observe(expression, text)
+	}
+	assert.Equal(t, LeafStat{Expression: "deadlock", Hits: 1, Samples: 6}, stats.Snapshot()[2])
+	prob, ok := stats.Selectivity(&ExpressionMeta{Keyword: "ERROR", IsNegative: true})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 5.0/8, prob)
+
+	// 少见的deadlock最先计算，“或”表达式里常见的timeout先计算
+	optimized := expression.Optimize(stats)
+	assert.Equal(t, "deadlock&ERROR&!INFO&(timeout|deadlock)", optimized.String())
+	assert.Equal(t, "ERROR&(timeout|deadlock)&!INFO&deadlock", expression.String())
+	for _, text := range corpus {
+		assert.Equal(t, expression.Match(text), optimized.Match(text), text)
+	}
+	// 已经是最优顺序的树被原样复用
+	assert.Equal(t, true, optimized.Optimize(stats).GetExpression() == optimized.GetExpression())
+
+	// 没有统计数据时，长的关键词先计算
+	expression, cerr = Compile("a&abcdef&abc")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "abcdef&abc&a", expression.Optimize(nil).String())
+}
+
+func TestExplain(t *testing.T) {
+	expression, cerr := CompileWithOptions("(paymnet~1|退款)&!timeout", CompileOptions{Syntax: Syntax_Fuzzy})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	explanation := expression.Explain("order 42: payment failed")
+	assert.Equal(t, true, explanation.Match)
+	assert.Equal(t, "[hit]  (paymnet~1|退款)&!timeout\n"+
+		"  [hit]  paymnet~1|退款\n"+
+		"    [hit]  paymnet~1 (found \"payment\" at offset 10, distance 1)\n"+
+		"    [miss] 退款 (not found)\n"+
+		"  [hit]  !timeout (not found)\n", explanation.String())
+}
+
+// 配合 go test -race 运行，验证同一个LogExp可以被多个goroutine并发使用
+func TestConcurrentMatch(t *testing.T) {
+	expression, cerr := Compile("(!(hello&!we)|hi)&wow")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	texts := map[string]bool{
+		"hello world":        false,
+		"we hello world wow": true,
+		"hi wow":             true,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for text, match := range texts {
+					if expression.Match(text) != match {
+						t.Errorf("unexpected result for %v", text)
+					}
+				}
+				// 并发改写不影响原表达式
+				if _, cerr := expression.Rewrite(func(exp IExpression) (IExpression, *CstError) {
+					return withNegative(exp, !exp.GetIsNegative()), nil
+				}); cerr != nil {
+					t.Error(cerr)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "(!(hello&!we)|hi)&wow", expression.String())
+}
+
+func TestProgram(t *testing.T) {
+	expression, cerr := Compile("!(a&!b)|c")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "  0 meta \"a\"\n"+
+		"  1 jump_if_false 4\n"+
+		"  2 meta \"b\"\n"+
+		"  3 not\n"+
+		"  4 not\n"+
+		"  5 jump_if_true 7\n"+
+		"  6 meta \"c\"\n", expression.program.String())
+
+	// 指令序列跟表达式树的求值结果一致
+	rnd := rand.New(rand.NewSource(1))
+	var randExp func(depth int) string
+	randExp = func(depth int) string {
+		s := string("abcd"[rnd.Intn(4)])
+		if depth > 0 && rnd.Intn(3) > 0 {
+			n := 2 + rnd.Intn(3)
+			parts := make([]string, n)
+			for i := range parts {
+				parts[i] = randExp(depth - 1)
+			}
+			s = "(" + strings.Join(parts, []string{"|", "&"}[rnd.Intn(2)]) + ")"
+		}
+		if rnd.Intn(3) == 0 {
+			s = "!" + s
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		exp := randExp(3)
+		expression, cerr := Compile(exp)
+		assert.Equal(t, (*CstError)(nil), cerr, exp)
+		for mask := 0; mask < 16; mask++ {
+			text := ""
+			for j := 0; j < 4; j++ {
+				if mask&(1<<uint(j)) != 0 {
+					text += string("abcd"[j])
+				}
+			}
+			assert.Equal(t, expression.GetExpression().Match(text), expression.Match(text), fmt.Sprintf("%v on %q", exp, text))
+		}
+	}
+
+	// 共用的子表达式只生成一次，指令数跟展开后的大小无关
+	chain := NewRegistry()
+	assert.Equal(t, (*CstError)(nil), chain.Define("d0", "x0|!z"))
+	for i := 1; i <= 22; i++ {
+		assert.Equal(t, (*CstError)(nil), chain.Define(fmt.Sprintf("d%v", i), fmt.Sprintf("(@d%v|x%v)&!(@d%v&y%v)", i-1, i, i-1, i)))
+	}
+	expression, cerr = CompileWithOptions("@d22|@d21", CompileOptions{Registry: chain})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, len(expression.program.code) < 400, len(expression.program.code))
+	assert.Equal(t, true, len(expression.program.keywords) < 100, len(expression.program.keywords))
+	expression, cerr = CompileWithOptions("@d4&!@d2", CompileOptions{Registry: chain})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, true, strings.Contains(expression.program.String(), "call"))
+	for i := 0; i < 500; i++ {
+		words := make([]string, 0, 10)
+		for _, w := range []string{"x0", "z", "x1", "y1", "x2", "y2", "x3", "y3", "x4", "y4"} {
+			if rnd.Intn(2) == 0 {
+				words = append(words, w)
+			}
+		}
+		text := strings.Join(words, " ")
+		assert.Equal(t, expression.GetExpression().Match(text), expression.Match(text), text)
+		ids := make([]int32, len(expression.program.keywords))
+		for j := range ids {
+			ids[j] = int32(j)
+		}
+		assert.Equal(t, expression.GetExpression().Match(text), expression.program.matchMemo(text, ids, make([]uint8, len(ids))), text)
+	}
+}
+
+// 零内存分配测试的用例：覆盖各种规范化方式和叶子节点
+// 时间表达式使用默认的格式；指定其他TimeOptions.Layouts时用time.Parse解析，可能分配内存，不在这里测试
+type zeroAllocCase struct {
+	Name string
+	Exp  string
+	Opts CompileOptions
+}
+
+var zeroAllocCases = []zeroAllocCase{
+	{Name: "plain", Exp: "(ERROR|FATAL|panic)&!(healthcheck|/metrics)|status=5&(payment|order)&!retry"},
+	{Name: "fold_case", Exp: "error&payment failed|deadlock", Opts: CompileOptions{Fold: Fold_Case}},
+	{Name: "fold_nfkc", Exp: "ERROR&服务", Opts: CompileOptions{Fold: Fold_NFKC}},
+	{Name: "fold_chinese_variant", Exp: "错误&(连接失败|超时)", Opts: CompileOptions{Fold: Fold_ChineseVariant}},
+	{Name: "fold_all", Exp: "error&服务|超时", Opts: CompileOptions{Fold: Fold_NFKC | Fold_ChineseVariant | Fold_Case}},
+	{Name: "synonyms", Exp: "oom|timeout&!healthcheck", Opts: CompileOptions{Fold: Fold_Case, Synonyms: Synonyms{
+		"oom":     {"out of memory", "OutOfMemoryError"},
+		"timeout": {"timed out", "超时", "超時"},
+	}}},
+	{Name: "pinyin_full", Exp: "zhifu shibai|kucun", Opts: CompileOptions{Pinyin: PinyinMode_Full}},
+	{Name: "pinyin_initials", Exp: "zfcg|tkclz", Opts: CompileOptions{Pinyin: PinyinMode_Initials}},
+	{Name: "fuzzy", Exp: "paymnet~1&!deadlok~1", Opts: CompileOptions{Syntax: Syntax_Fuzzy}},
+	{Name: "compare", Exp: "status>=500|latency_ms:[1000 TO *]|rt>0.9", Opts: CompileOptions{Syntax: Syntax_Compare}},
+	{Name: "time", Exp: "@time:[2026-10-19T08:00:00Z TO 2026-10-19T12:00:00Z]|@time in last 1h", Opts: CompileOptions{Syntax: Syntax_Time}},
+	{Name: "time_field", Exp: "@time<2026-10-19T06:00:00Z", Opts: CompileOptions{Syntax: Syntax_Time, Time: TimeOptions{Field: "ts"}}},
+	{Name: "time_default_layouts", Exp: "@time<2026-10-19T06:00:00Z", Opts: CompileOptions{Syntax: Syntax_Time, Time: TimeOptions{Layouts: DefaultTimeLayouts}}},
+	{Name: "anchors", Exp: "^10.0.&HTTP/1.1\" 5|rt=0.9&.json$|=done", Opts: CompileOptions{Syntax: Syntax_Anchors}},
+}
+
+// 读取testdata下的日志语料，每行一条
+func loadCorpus(tb testing.TB) []string {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.log"))
+	if err != nil || len(files) == 0 {
+		tb.Fatalf("no corpus in testdata: %v", err)
+	}
+	lines := make([]string, 0)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+func compileZeroAllocCase(tb testing.TB, cas zeroAllocCase) *LogExp {
+	now := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	cas.Opts.Time.Now = func() time.Time { return now }
+	expression, cerr := CompileWithOptions(cas.Exp, cas.Opts)
+	if cerr != nil {
+		tb.Fatalf("%v: %v", cas.Name, cerr)
+	}
+	return expression
+}
+
+func TestMatchZeroAlloc(t *testing.T) {
+	lines := loadCorpus(t)
+	for _, cas := range zeroAllocCases {
+		expression := compileZeroAllocCase(t, cas)
+		tree := expression.GetExpression()
+		hits := 0
+		for _, line := range lines {
+			match := expression.Match(line)
+			assert.Equal(t, tree.Match(foldString(line, cas.Opts.Fold)), match, fmt.Sprintf("%v: %v", cas.Name, line))
+			if match {
+				hits++
+			}
+		}
+		assert.NotEqual(t, 0, hits, cas.Name)
+		if raceEnabled {
+			continue
+		}
+		allocs := testing.AllocsPerRun(20, func() {
+			for _, line := range lines {
+				expression.Match(line)
+			}
+		})
+		assert.Equal(t, 0.0, allocs, cas.Name)
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	expression, cerr := CompileWithOptions("Payment Failed&!ΣΦΑΛΜΑ", CompileOptions{Fold: Fold_Case})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "payment failed&!σφαλμα", expression.String())
+	assert.Equal(t, true, expression.Match("PAYMENT FAILED: timeout"))
+	assert.Equal(t, false, expression.Match("payment failed: Σφαλμα"))
+	assert.Equal(t, "支付失败 error", foldString("支付失敗 ERROR", Fold_ChineseVariant|Fold_Case))
+	assert.Equal(t, "error ﬁle", foldString("error ﬁle", Fold_Case))
+	assert.Equal(t, "error file", foldString("ＥＲＲＯＲ ﬁle", Fold_NFKC|Fold_Case))
+	// 超过maxPooledFoldBuffer的长文本不放回缓冲池，结果不受影响
+	long := strings.Repeat("X", maxPooledFoldBuffer) + " PAYMENT FAILED"
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, true, expression.Match(long))
+		assert.Equal(t, false, expression.Match(long+" σφαλμα"))
+	}
+}
+
+func TestRuleSet(t *testing.T) {
+	lines := loadCorpus(t)
+	// 让文本条数跨过多个并发块
+	for len(lines) < 3*batchChunkSize {
+		lines = append(lines, lines...)
+	}
+	set := NewRuleSet()
+	exps := make([]*LogExp, 0, len(zeroAllocCases))
+	for _, cas := range zeroAllocCases {
+		expression := compileZeroAllocCase(t, cas)
+		exps = append(exps, expression)
+		assert.Equal(t, (*CstError)(nil), set.Add(cas.Name, expression))
+	}
+	assert.Equal(t, 0, len(set.MatchBatchParallel(nil, 4)))
+
+	// 规则集的结果跟逐条规则匹配相同
+	check := func(res [][]bool) {
+		assert.Equal(t, len(lines), len(res))
+		for i, line := range lines {
+			for j, expression := range exps {
+				assert.Equal(t, expression.Match(line), res[i][j], fmt.Sprintf("%v: %v", zeroAllocCases[j].Name, line))
+			}
+		}
+	}
+	check(set.MatchBatch(lines))
+	check(set.MatchBatchParallel(lines, 0))
+	check(set.MatchBatchParallel(lines, 5))
+	single := make([][]bool, len(lines))
+	for i, line := range lines {
+		single[i] = set.Match(line)
+	}
+	check(single)
+	// 匹配单条文本只分配返回的结果
+	if !raceEnabled {
+		allocs := testing.AllocsPerRun(20, func() {
+			set.Match(lines[0])
+		})
+		assert.Equal(t, 1.0, allocs)
+	}
+	assert.Equal(t, len(zeroAllocCases), len(set.Names()))
+	assert.Equal(t, "plain", set.Names()[0])
+
+	// 同名的规则被替换，位置不变
+	replaced, _ := Compile("payment")
+	assert.Equal(t, (*CstError)(nil), set.Add("plain", replaced))
+	exps[0] = replaced
+	check(set.MatchBatchParallel(lines, 2))
+	assert.Equal(t, []bool{true}, set.Match("payment failed")[:1])
+	assert.NotEqual(t, (*CstError)(nil), set.Add("", replaced))
+	assert.NotEqual(t, (*CstError)(nil), set.Add("nil", nil))
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2)
+	a1, cerr := cache.Compile("ERROR&payment")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	a2, _ := cache.Compile("ERROR&payment")
+	assert.Equal(t, true, a1 == a2)
+
+	// 选项不同时分别缓存
+	folded, _ := cache.CompileWithOptions("ERROR&payment", CompileOptions{Fold: Fold_Case})
+	assert.Equal(t, true, folded != a1)
+	assert.Equal(t, true, folded.Match("error: Payment failed"))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Len: 2, Capacity: 2}, cache.Stats())
+
+	// 淘汰最久没有使用的
+	cache.Compile("ERROR&payment")
+	cache.Compile("timeout")
+	again, _ := cache.CompileWithOptions("ERROR&payment", CompileOptions{Fold: Fold_Case})
+	assert.Equal(t, true, again != folded)
+	a3, _ := cache.Compile("ERROR&payment")
+	assert.Equal(t, true, a3 != a1)
+
+	// Registry按引用区分
+	r1, r2 := NewRegistry(), NewRegistry()
+	r1.Define("db", "deadlock")
+	r2.Define("db", "lock wait")
+	e1, _ := cache.CompileWithOptions("@db", CompileOptions{Registry: r1})
+	e2, _ := cache.CompileWithOptions("@db", CompileOptions{Registry: r2})
+	assert.Equal(t, "deadlock", e1.String())
+	assert.Equal(t, "lock wait", e2.String())
+	// Registry修改了定义之后重新编译，不需要Purge
+	same, _ := cache.CompileWithOptions("@db", CompileOptions{Registry: r1})
+	assert.Equal(t, true, same == e1)
+	r1.Define("db", "too many connections")
+	e3, _ := cache.CompileWithOptions("@db", CompileOptions{Registry: r1})
+	assert.Equal(t, "too many connections", e3.String())
+	// 缓存项持有按地址区分的选项的引用，它们的地址不会被别的对象复用
+	for elem := cache.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*cacheEntry)
+		if entry.exp == e3 {
+			assert.Equal(t, true, entry.refs.registry == r1)
+		}
+	}
+
+	// 编译失败和设置了TimeOptions.Now的编译不缓存
+	_, cerr = cache.Compile("(a|b")
+	assert.NotEqual(t, (*CstError)(nil), cerr)
+	now := func() time.Time { return time.Now() }
+	n1, _ := cache.CompileWithOptions("@time in last 1h", CompileOptions{Syntax: Syntax_Time, Time: TimeOptions{Now: now}})
+	n2, _ := cache.CompileWithOptions("@time in last 1h", CompileOptions{Syntax: Syntax_Time, Time: TimeOptions{Now: now}})
+	assert.Equal(t, true, n1 != n2)
+	assert.Equal(t, 2, cache.Stats().Len)
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Stats().Len)
+	assert.Equal(t, defaultCacheSize, NewCache(0).Stats().Capacity)
+
+	// 并发使用
+	cache = NewCache(8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				exp, cerr := cache.Compile(fmt.Sprintf("ERROR&k%v", (i+j)%12))
+				assert.Equal(t, (*CstError)(nil), cerr)
+				assert.Equal(t, true, exp.Match(fmt.Sprintf("ERROR k%v", (i+j)%12)))
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1600), stats.Hits+stats.Misses)
+	assert.Equal(t, 8, stats.Len)
+}
+
+func TestMustCompile(t *testing.T) {
+	assert.Equal(t, "a&b", MustCompile("a&b").String())
+	assert.Equal(t, "a&b", MustCompileWithOptions("a b", CompileOptions{Syntax: Syntax_ImplicitAnd}).String())
+	defer func() {
+		cerr, ok := recover().(*CstError)
+		assert.Equal(t, true, ok)
+		assert.Equal(t, ErrCodeInvalidExpression, cerr.Code)
+	}()
+	MustCompile("(a|b")
+}
+
+func TestIndex(t *testing.T) {
+	lines := loadCorpus(t)
+	for _, fold := range []Fold{0, Fold_Case, Fold_NFKC | Fold_ChineseVariant | Fold_Case} {
+		index := NewIndex(fold)
+		for i, line := range lines {
+			assert.Equal(t, i, index.Add(line))
+		}
+		assert.Equal(t, len(lines), index.Len())
+		assert.Equal(t, lines[3], index.Doc(3))
+
+		exps := make([]*LogExp, 0)
+		for _, cas := range zeroAllocCases {
+			exps = append(exps, compileZeroAllocCase(t, cas))
+		}
+		for _, exp := range []string{"payment&(timeout|deadlock)", "支付&!成功", "ERROR|FATAL", "a|deadlock", "nothing-like-this|\"lock wait\"", "!healthcheck&GET"} {
+			exps = append(exps, MustCompileWithOptions(exp, CompileOptions{Fold: fold}))
+		}
+		for _, exp := range exps {
+			want := make([]int, 0)
+			for id, line := range lines {
+				if exp.Match(line) {
+					want = append(want, id)
+				}
+			}
+			assert.Equal(t, want, index.Search(exp), fmt.Sprintf("fold %v: %v", fold, exp))
+		}
+	}
+
+	// 候选文档只包含含有所有关键词的文档
+	index := NewIndex(0)
+	for _, line := range lines {
+		index.Add(line)
+	}
+	type Case struct {
+		Exp string
+		All bool // 索引无法缩小范围
+	}
+	testCases := []Case{
+		{Exp: "deadlock&payment"},
+		{Exp: "nothing-like-this"},
+		{Exp: "deadlock&ab"},
+		{Exp: "deadlock|OutOfMemoryError"},
+		{Exp: "ab", All: true},
+		{Exp: "!deadlock", All: true},
+		{Exp: "deadlock|ab", All: true},
+	}
+	for _, cas := range testCases {
+		exp := MustCompile(cas.Exp)
+		ids, all := index.candidates(exp)
+		assert.Equal(t, cas.All, all, cas.Exp)
+		if !cas.All {
+			assert.Equal(t, true, len(ids) < len(lines)/2, cas.Exp)
+			assert.Equal(t, true, len(index.Search(exp)) <= len(ids), cas.Exp)
+		}
+	}
+	_, all := index.candidates(MustCompileWithOptions("deadlock", CompileOptions{Fold: Fold_Case}))
+	assert.Equal(t, true, all)
+	assert.Equal(t, []uint32{1, 2, 3, 5, 7}, union([]uint32{1, 3, 5}, []uint32{2, 3, 7}))
+	assert.Equal(t, []uint32{3}, intersect([]uint32{1, 3, 5}, []uint32{2, 3, 7}))
+}
+
+func TestDiskIndex(t *testing.T) {
+	lines := loadCorpus(t)
+	dir := t.TempDir()
+	exps := make([]*LogExp, 0)
+	for _, cas := range zeroAllocCases {
+		exps = append(exps, compileZeroAllocCase(t, cas))
+	}
+	for _, exp := range []string{"payment&(timeout|deadlock)", "支付&!成功", "ERROR|FATAL", "nothing-like-this", "^10.0.&GET"} {
+		exps = append(exps, MustCompileWithOptions(exp, CompileOptions{Syntax: Syntax_Anchors}))
+	}
+	// 检查索引的查询结果跟逐条Match相同
+	check := func(index *DiskIndex, docs []string) {
+		assert.Equal(t, len(docs), index.Len())
+		for id := range docs {
+			assert.Equal(t, docs[id], index.Doc(id))
+		}
+		for _, exp := range exps {
+			want := make([]int, 0)
+			for id, doc := range docs {
+				if exp.Match(doc) {
+					want = append(want, id)
+				}
+			}
+			assert.Equal(t, want, index.Search(exp), exp.String())
+		}
+	}
+
+	index, cerr := OpenDiskIndex(dir, 0)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	half := len(lines) / 2
+	for i, line := range lines[:half] {
+		assert.Equal(t, i, index.Add(line))
+	}
+	check(index, lines[:half])
+	assert.Equal(t, (*CstError)(nil), index.Flush())
+	for _, line := range lines[half:] {
+		index.Add(line)
+	}
+	check(index, lines)
+	assert.Equal(t, (*CstError)(nil), index.Flush())
+	assert.Equal(t, (*CstError)(nil), index.Flush())
+	assert.Equal(t, 2, index.Segments())
+	check(index, lines)
+	// 同一个目录同时只能被一个DiskIndex打开
+	_, cerr = OpenDiskIndex(dir, 0)
+	assert.Equal(t, ErrCodeIndexLocked, cerr.Code)
+	assert.Equal(t, (*CstError)(nil), index.Close())
+
+	// 重新打开之后不需要重新建立索引
+	index, cerr = OpenDiskIndex(dir, 0)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, 2, index.Segments())
+	check(index, lines)
+	oldSegment := filepath.Join(dir, segmentFileName(0, 0))
+	oldData, err := os.ReadFile(oldSegment)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, (*CstError)(nil), index.Merge())
+	assert.Equal(t, 1, index.Segments())
+	check(index, lines)
+	docs := append([]string(nil), lines...)
+	for _, line := range lines[:10] {
+		index.Add(line)
+		docs = append(docs, line)
+	}
+	check(index, docs)
+	assert.Equal(t, (*CstError)(nil), index.Close())
+
+	// 合并之后没有来得及删除的旧段和写到一半的段文件在打开时被删除
+	assert.Equal(t, nil, os.WriteFile(oldSegment, oldData, 0644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, segmentFileName(3, 3)+".tmp"), []byte("partial"), 0644))
+	index, cerr = OpenDiskIndex(dir, 0)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, 2, index.Segments())
+	check(index, docs)
+	index.Close()
+	entries, _ := os.ReadDir(dir)
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if entry.Name() != lockFileName {
+			names = append(names, entry.Name())
+		}
+	}
+	assert.Equal(t, []string{segmentFileName(0, 1), segmentFileName(2, 2)}, names)
+
+	// Fold不同或者段文件损坏时打开失败
+	_, cerr = OpenDiskIndex(dir, Fold_Case)
+	assert.Equal(t, ErrCodeIndexFormat, cerr.Code)
+	data, _ := os.ReadFile(filepath.Join(dir, segmentFileName(2, 2)))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, segmentFileName(2, 2)), data[:len(data)-4], 0644))
+	_, cerr = OpenDiskIndex(dir, 0)
+	assert.Equal(t, ErrCodeIndexFormat, cerr.Code)
+
+	// 倒排表中的文档编号越界、三元组顺序错乱时打开失败，而不是在查询时越界
+	path := filepath.Join(dir, segmentFileName(2, 2))
+	assert.Equal(t, nil, os.WriteFile(path, data, 0644))
+	seg, cerr := openSegment(path, 2, 2, 0)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	postingsAt, gramsAt := seg.postingsAt, seg.gramsAt
+	seg.close()
+	corrupt := func(at int, value uint32) {
+		bad := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(bad[at:], value)
+		assert.Equal(t, nil, os.WriteFile(path, bad, 0644))
+		_, cerr := OpenDiskIndex(dir, 0)
+		assert.Equal(t, ErrCodeIndexFormat, cerr.Code)
+	}
+	corrupt(postingsAt, 1<<30)
+	corrupt(gramsAt, 0xffffff)
+	corrupt(gramsAt+8, 1<<30)
+
+	// 写段文件期间继续添加和查询文档，编号连续，查询结果不缺少正在写入的文档
+	dir = t.TempDir()
+	index, cerr = OpenDiskIndex(dir, 0)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	payment := MustCompile("payment")
+	for i := 0; i < 2000; i++ {
+		index.Add(fmt.Sprintf("payment %v failed", i))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			doc := fmt.Sprintf("payment %v retried", i)
+			id := index.Add(doc)
+			assert.Equal(t, 2000+i, id)
+			assert.Equal(t, doc, index.Doc(id))
+			assert.Equal(t, id+1, len(index.Search(payment)))
+		}
+	}()
+	assert.Equal(t, (*CstError)(nil), index.Flush())
+	wg.Wait()
+	assert.Equal(t, 2050, len(index.Search(payment)))
+	assert.Equal(t, (*CstError)(nil), index.Close())
+	index, cerr = OpenDiskIndex(dir, 0)
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, 2, index.Segments())
+	assert.Equal(t, 2050, len(index.Search(payment)))
+	index.Close()
+}
+
+var benchmarkText = "2026-10-19T11:50:00Z INFO GET /api/orders/42 status=200 latency=12ms user=alice trace=9f1c2e"
+
+func BenchmarkMatchTree(b *testing.B) {
+	expression, _ := Compile("(ERROR|FATAL|panic)&!(healthcheck|/metrics)|status=5&(payment|order)&!retry")
+	tree := expression.GetExpression()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Match(benchmarkText)
+	}
+}
+
+func BenchmarkMatchProgram(b *testing.B) {
+	expression, _ := Compile("(ERROR|FATAL|panic)&!(healthcheck|/metrics)|status=5&(payment|order)&!retry")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expression.Match(benchmarkText)
+	}
+}
+
+// 在真实风格的日志语料上测试匹配性能，每个用例都必须不分配内存（用例不包含会用time.Parse的自定义TimeOptions.Layouts）
+func BenchmarkMatchCorpus(b *testing.B) {
+	lines := loadCorpus(b)
+	for _, cas := range zeroAllocCases {
+		expression := compileZeroAllocCase(b, cas)
+		b.Run(cas.Name, func(b *testing.B) {
+			allocs := testing.AllocsPerRun(10, func() {
+				for _, line := range lines {
+					expression.Match(line)
+				}
+			})
+			if allocs != 0 && !raceEnabled {
+				b.Fatalf("%v allocs per run over the corpus, want 0", allocs)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				expression.Match(lines[i%len(lines)])
+			}
+		})
+	}
+}
+
+// 逐条规则匹配跟规则集批量匹配的对比，规则之间有大量相同的关键词
+func BenchmarkRuleSet(b *testing.B) {
+	lines := loadCorpus(b)
+	set := NewRuleSet()
+	exps := make([]*LogExp, 0)
+	for _, service := range []string{"payment", "order", "gateway", "auth", "cart", "login"} {
+		for _, level := range []string{"ERROR", "FATAL", "WARN"} {
+			expression, _ := Compile(level + "&" + service + "&(timeout|deadlock|connection reset|OutOfMemoryError)&!healthcheck")
+			exps = append(exps, expression)
+			set.Add(service+"_"+level, expression)
+		}
+	}
+	b.Run("each", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, line := range lines {
+				for _, expression := range exps {
+					expression.Match(line)
+				}
+			}
+		}
+	})
+	b.Run("set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			set.MatchBatch(lines)
+		}
+	})
+	b.Run("set_parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			set.MatchBatchParallel(lines, 0)
+		}
+	})
+}
+
+// 索引查询跟逐条匹配的对比
+func BenchmarkIndex(b *testing.B) {
+	lines := loadCorpus(b)
+	index := NewIndex(0)
+	for i := 0; i < 100; i++ {
+		for _, line := range lines {
+			index.Add(line)
+		}
+	}
+	exp := MustCompile("deadlock&(payment|order)&!healthcheck")
+	b.Run("search", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			index.Search(exp)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for id := 0; id < index.Len(); id++ {
+				exp.Match(index.Doc(id))
+			}
+		}
+	})
+}
+
 func BenchmarkNew(b *testing.B) {
 	for idx := 0; idx < b.N; idx++ {
 		exp, _ := Compile("hello|hi|we")
@@ -216,3 +1552,202 @@ func BenchmarkNew(b *testing.B) {
 		}
 	}
 }
+
+func TestDiff(t *testing.T) {
+	type Case struct {
+		A    string
+		B    string
+		Diff ExpDiff
+	}
+	testCases := []Case{
+		{
+			A:    "hello|(hi&wow)",
+			B:    "(wow&hi)|hello",
+			Diff: ExpDiff{AddedKeywords: []string{}, RemovedKeywords: []string{}, FlippedNegations: []string{}, Restructured: []string{}},
+		},
+		{
+			A:    "hello&hi&wow",
+			B:    "hello&hi&we",
+			Diff: ExpDiff{AddedKeywords: []string{"we"}, RemovedKeywords: []string{"wow"}, FlippedNegations: []string{}, Restructured: []string{}},
+		},
+		{
+			A:    "wow&!(hello|hi)",
+			B:    "wow&(hello|hi)",
+			Diff: ExpDiff{AddedKeywords: []string{}, RemovedKeywords: []string{}, FlippedNegations: []string{"hello|hi"}, Restructured: []string{}},
+		},
+		{
+			A:    "(hello|hi)&wow",
+			B:    "hello|(hi&wow)",
+			Diff: ExpDiff{AddedKeywords: []string{}, RemovedKeywords: []string{}, FlippedNegations: []string{}, Restructured: []string{"hello|(hi&wow)", "hi&wow"}},
+		},
+	}
+	for idx, cas := range testCases {
+		a, cerr := Compile(cas.A)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.A))
+		b, cerr := Compile(cas.B)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.B))
+		diff := Diff(a, b)
+		assert.Equal(t, cas.Diff, *diff, fmt.Sprintf("case %v: %v => %v", idx, cas.A, cas.B))
+		assert.Equal(t, idx == 0, diff.IsEmpty(), fmt.Sprintf("case %v", idx))
+	}
+}
+
+type keywordCollector struct {
+	keywords []string
+	depth    int
+	maxDepth int
+}
+
+func (c *keywordCollector) Enter(exp IExpression) bool {
+	c.depth++
+	if c.depth > c.maxDepth {
+		c.maxDepth = c.depth
+	}
+	if meta, ok := exp.(*ExpressionMeta); ok {
+		c.keywords = append(c.keywords, meta.Keyword)
+	}
+	return true
+}
+
+func (c *keywordCollector) Leave(exp IExpression) {
+	c.depth--
+}
+
+func TestWalkAndRewrite(t *testing.T) {
+	expression, cerr := Compile("hello&(hi|!wow)")
+	assert.Equal(t, (*CstError)(nil), cerr)
+	collector := keywordCollector{}
+	expression.Walk(&collector)
+	assert.Equal(t, []string{"hello", "hi", "wow"}, collector.keywords)
+	assert.Equal(t, 3, collector.maxDepth)
+	assert.Equal(t, 0, collector.depth)
+
+	type Case struct {
+		Exp     string
+		Rewrite RewriteFunc
+		Result  string
+	}
+	testCases := []Case{
+		{
+			// 关键词展开成同义词，展开后的“或”表达式会并入父表达式
+			Exp: "hello|hi",
+			Rewrite: func(exp IExpression) (IExpression, *CstError) {
+				if meta, ok := exp.(*ExpressionMeta); ok && meta.Keyword == "hi" {
+					return NewExpressionOr([]rune("hey|yo"), meta.IsNegative, 0)
+				}
+				return exp, nil
+			},
+			Result: "hello|hey|yo",
+		},
+		{
+			// 删除节点后只剩一个子表达式，往上提时保留取非标记
+			Exp: "!(hello&hi)|wow",
+			Rewrite: func(exp IExpression) (IExpression, *CstError) {
+				if meta, ok := exp.(*ExpressionMeta); ok && meta.Keyword == "hi" {
+					return nil, nil
+				}
+				return exp, nil
+			},
+			Result: "!hello|wow",
+		},
+	}
+	for idx, cas := range testCases {
+		expression, cerr := Compile(cas.Exp)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		rewritten, cerr := expression.Rewrite(cas.Rewrite)
+		assert.Equal(t, (*CstError)(nil), cerr, fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Result, rewritten.String(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+		assert.Equal(t, cas.Exp, expression.String(), fmt.Sprintf("case %v: %v", idx, cas.Exp))
+	}
+
+	// 包外实现的表达式不需要实现String，文本形式使用fmt的默认格式
+	expression, _ = Compile("hello&!hi")
+	rewritten, cerr := expression.Rewrite(func(exp IExpression) (IExpression, *CstError) {
+		if meta, ok := exp.(*ExpressionMeta); ok && meta.Keyword == "hi" {
+			return &lengthExpression{Min: 8, IsNegative: meta.IsNegative}, nil
+		}
+		return exp, nil
+	})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	assert.Equal(t, "hello&&{8 true}", rewritten.String())
+	assert.Equal(t, true, rewritten.Match("hello"))
+	assert.Equal(t, false, rewritten.Match("hello world"))
+	assert.Equal(t, []string{"&{8 true}"}, Diff(expression, rewritten).AddedKeywords)
+	stats := NewStats()
+	stats.Observe(rewritten, "hello world")
+	assert.Equal(t, rewritten.Match("hello"), rewritten.Optimize(stats).Match("hello"))
+}
+
+// 包外实现的表达式：文本不少于Min个字节
+type lengthExpression struct {
+	Min        int
+	IsNegative bool
+}
+
+func (e *lengthExpression) GetIsNegative() bool     { return e.IsNegative }
+func (e *lengthExpression) GetType() ExpressionType { return ExpressionType_Meta }
+func (e *lengthExpression) GetExps() []IExpression  { return nil }
+func (e *lengthExpression) Match(text string) bool  { return (len(text) >= e.Min) != e.IsNegative }
+
+// 层层引用的定义，每一层引用上一层两次，展开后的大小是指数级的
+func sharedChain(t *testing.T, depth int) *Registry {
+	chain := NewRegistry()
+	assert.Equal(t, (*CstError)(nil), chain.Define("d0", "x0|!z"))
+	for i := 1; i <= depth; i++ {
+		assert.Equal(t, (*CstError)(nil), chain.Define(fmt.Sprintf("d%v", i), fmt.Sprintf("(@d%v|x%v)&!(@d%v&y%v)", i-1, i, i-1, i)))
+	}
+	return chain
+}
+
+func TestSharedSubexpressions(t *testing.T) {
+	// 遍历表达式树的功能对共用的子表达式只计算一次，耗时跟展开后的大小无关
+	expression, cerr := CompileWithOptions("@d20", CompileOptions{Registry: sharedChain(t, 20)})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	texts := []string{"x0 x1 y2 x5", "z y1 y2 y3", "x20", ""}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, text := range texts {
+			explanation := expression.Explain(text)
+			assert.Equal(t, expression.Match(text), explanation.Match, text)
+			hit, err := expression.MatchContext(context.Background(), text)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, expression.Match(text), hit, text)
+		}
+		collector := keywordCollector{}
+		expression.Walk(&collector)
+		assert.Equal(t, true, len(collector.keywords) < 100, len(collector.keywords))
+		stats := NewStats()
+		stats.Observe(expression, texts[0])
+		rewritten, cerr := expression.Rewrite(func(exp IExpression) (IExpression, *CstError) {
+			return exp, nil
+		})
+		assert.Equal(t, (*CstError)(nil), cerr)
+		assert.Equal(t, len(expression.program.code), len(rewritten.program.code))
+		// 重排之后共用的子表达式仍然共用，指令数不会变多
+		stats.Observe(expression, texts[1])
+		for _, s := range []*Stats{nil, stats} {
+			optimized := expression.Optimize(s)
+			assert.Equal(t, len(expression.program.code), len(optimized.program.code))
+			for _, text := range texts {
+				assert.Equal(t, expression.Match(text), optimized.Match(text), text)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("walking shared subexpressions takes exponential time")
+	}
+
+	// 小一些的表达式，逐节点跟展开后的树比较
+	small, cerr := CompileWithOptions("@d3&!@d2", CompileOptions{Registry: sharedChain(t, 3)})
+	assert.Equal(t, (*CstError)(nil), cerr)
+	expanded, cerr := Compile(small.String())
+	assert.Equal(t, (*CstError)(nil), cerr)
+	for _, text := range []string{"x0", "z", "x1 y1 x2", "x3 y3 x0", "y2 y3"} {
+		assert.Equal(t, expanded.Explain(text).Match, small.Explain(text).Match, text)
+		assert.Equal(t, expanded.Match(text), small.Match(text), text)
+	}
+	assert.Equal(t, true, strings.Contains(small.Explain("x0").String(), "(same as above)"))
+}
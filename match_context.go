@@ -0,0 +1,100 @@
+package logexp
+
+import (
+	"context"
+	"strings"
+)
+
+// 流式扫描时每一块文本的大小，每扫描完一块检查一次ctx
+const scanChunkSize = 64 * 1024
+
+// 支持取消的匹配
+type contextMatcher interface {
+	matchContext(ctx context.Context, text string) (bool, error)
+}
+
+// 一次支持取消的匹配，被多处引用的同一个“或”、“且”表达式只计算一次
+type contextMatch struct {
+	ctx  context.Context
+	text string
+	memo map[IExpression]bool
+}
+
+func (m *contextMatch) match(exp IExpression) (bool, error) {
+	switch e := exp.(type) {
+	case *ExpressionAnd:
+		return m.group(e, e.Exps, true, e.IsNegative)
+	case *ExpressionOr:
+		return m.group(e, e.Exps, false, e.IsNegative)
+	}
+	if leaf, ok := exp.(contextMatcher); ok {
+		return leaf.matchContext(m.ctx, m.text)
+	}
+	// 没有实现contextMatcher的表达式，只在匹配前检查一次ctx
+	if err := m.ctx.Err(); err != nil {
+		return false, err
+	}
+	return exp.Match(m.text), nil
+}
+
+/*
+ * “且”表达式遇到false、“或”表达式遇到true时短路
+ * @Param isAnd: 是否是“且”表达式
+ */
+func (m *contextMatch) group(exp IExpression, exps []IExpression, isAnd bool, isNegative bool) (bool, error) {
+	if res, ok := m.memo[exp]; ok {
+		return res, nil
+	}
+	res := isAnd
+	for i := range exps {
+		// 每计算一个子表达式前检查ctx
+		hit, err := m.match(exps[i])
+		if err != nil {
+			return false, err
+		}
+		if hit != isAnd {
+			res = !isAnd
+			break
+		}
+	}
+	if isNegative {
+		res = !res
+	}
+	m.memo[exp] = res
+	return res, nil
+}
+
+// 长文本分块扫描，相邻的块重叠len(Keyword)-1个字节，保证跨块的关键词不会被漏掉
+func (e *ExpressionMeta) matchContext(ctx context.Context, text string) (bool, error) {
+	res := false
+	for start := 0; start < len(text) || start == 0; start += scanChunkSize {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		end := start + scanChunkSize + len(e.Keyword) - 1
+		if end > len(text) {
+			end = len(text)
+		}
+		if strings.Contains(text[start:end], e.Keyword) {
+			res = true
+			break
+		}
+	}
+	if e.IsNegative {
+		res = !res
+	}
+	return res, nil
+}
+
+/*
+ * 跟Match一样判断表达式是否匹配给定的文本，但会在计算子表达式之间以及扫描长文本的过程中检查ctx
+ * ctx被取消或超时时返回ctx.Err()，此时返回的匹配结果没有意义
+ */
+func (e *LogExp) MatchContext(ctx context.Context, text string) (bool, error) {
+	m := contextMatch{
+		ctx:  ctx,
+		text: foldString(text, e.fold),
+		memo: make(map[IExpression]bool),
+	}
+	return m.match(e.expression)
+}
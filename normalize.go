@@ -0,0 +1,291 @@
+package logexp
+
+import (
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+)
+
+//go:generate sh -c "python3 tools/gen_nfkc_tables.py > nfkc_tables.go && gofmt -w nfkc_tables.go"
+
+type Fold int32 // 匹配前对关键词（编译时）和文本（匹配时）做的规范化，可以按位组合
+const (
+	Fold_NFKC           Fold = 1 << iota // Unicode NFKC规范化：统一组合/分解形式的重音字符，把全角字母数字、半角片假名、连字等兼容字符折叠成标准形式
+	Fold_ChineseVariant                  // 繁简体不敏感：把繁体字逐字折叠成简体字
+	Fold_Case                            // 大小写不敏感：把字母折叠成小写
+)
+
+// 缓冲区的容量超过这个值时不放回foldPool，避免偶尔的长文本长期占用内存；这样的长文本每次匹配都会重新分配缓冲区
+const maxPooledFoldBuffer = 64 * 1024
+
+/*
+ * 规范化用到的缓冲区
+ * 两个字节缓冲区轮流作为每一步规范化的输出，所以上一步的结果可以直接作为下一步的输入
+ */
+type foldBuffer struct {
+	runes   []rune
+	bytes   [2][]byte
+	cur     int  // 最近一次输出所在的字节缓冲区
+	changed bool // 文本是否发生了变化
+}
+
+// 匹配时从这里取缓冲区，匹配结束后放回，所以Match不需要分配内存
+var foldPool = sync.Pool{
+	New: func() interface{} {
+		return &foldBuffer{}
+	},
+}
+
+/*
+ * 按fold对文本做规范化
+ * 文本发生变化时，返回的字符串引用的是缓冲区的内存，只能在下一次使用缓冲区之前读取
+ */
+func (b *foldBuffer) fold(s string, fold Fold) string {
+	b.changed = false
+	if fold&Fold_NFKC != 0 {
+		s = b.nfkc(s)
+	}
+	if fold&Fold_ChineseVariant != 0 {
+		s = b.chineseVariant(s)
+	}
+	if fold&Fold_Case != 0 {
+		s = b.lower(s)
+	}
+	return s
+}
+
+// 返回本步规范化的输出缓冲区，它不是上一步的输出所在的缓冲区
+func (b *foldBuffer) output() []byte {
+	return b.bytes[b.cur^1][:0]
+}
+
+// 结束本步规范化，返回引用输出缓冲区的字符串
+func (b *foldBuffer) done(out []byte) string {
+	b.cur ^= 1
+	b.bytes[b.cur] = out
+	b.changed = true
+	return bytesToString(out)
+}
+
+func (b *foldBuffer) release() {
+	if cap(b.runes) > maxPooledFoldBuffer || cap(b.bytes[0]) > maxPooledFoldBuffer || cap(b.bytes[1]) > maxPooledFoldBuffer {
+		return
+	}
+	foldPool.Put(b)
+}
+
+// 按fold对文本做规范化，返回的字符串不引用任何缓冲区；用于编译关键词等不在意内存分配的场合
+func foldString(s string, fold Fold) string {
+	if fold == 0 {
+		return s
+	}
+	var b foldBuffer
+	folded := b.fold(s, fold)
+	if !b.changed {
+		return s
+	}
+	return string([]byte(folded))
+}
+
+// 把字节切片当作字符串使用，不复制；调用方必须保证字符串被使用期间不修改切片
+func bytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], r)
+	return append(buf, tmp[:n]...)
+}
+
+// 把繁体字逐字折叠成简体字，没有需要折叠的字时返回原文本
+func (b *foldBuffer) chineseVariant(s string) string {
+	for i, r := range s {
+		if _, ok := t2sTable[r]; ok {
+			out := append(b.output(), s[:i]...)
+			for _, r := range s[i:] {
+				out = appendRune(out, t2sRune(r))
+			}
+			return b.done(out)
+		}
+	}
+	return s
+}
+
+// 把字母折叠成小写，没有大写字母时返回原文本
+func (b *foldBuffer) lower(s string) string {
+	for i, r := range s {
+		if r < utf8.RuneSelf && ('A' > r || r > 'Z') {
+			continue
+		}
+		if unicode.ToLower(r) != r {
+			out := append(b.output(), s[:i]...)
+			for _, r := range s[i:] {
+				out = appendRune(out, unicode.ToLower(r))
+			}
+			return b.done(out)
+		}
+	}
+	return s
+}
+
+// 规范组合类的区间
+type cccRange struct {
+	lo    rune
+	hi    rune
+	class uint8
+}
+
+// 返回字符的规范组合类，0表示起始字符
+func combiningClass(r rune) uint8 {
+	i := sort.Search(len(cccTable), func(i int) bool {
+		return cccTable[i].hi >= r
+	})
+	if i < len(cccTable) && cccTable[i].lo <= r {
+		return cccTable[i].class
+	}
+	return 0
+}
+
+// 能作为规范合成的第二个字符的起始字符
+var composeSecond = func() map[rune]bool {
+	res := map[rune]bool{}
+	for pair := range composeTable {
+		if combiningClass(pair[1]) == 0 {
+			res[pair[1]] = true
+		}
+	}
+	return res
+}()
+
+// 韩文音节的算法分解、合成用到的常量
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// 判断字符在NFKC下是否一定保持不变，不需要走完整的规范化流程
+func nfkcStable(r rune) bool {
+	if r < utf8.RuneSelf {
+		return true
+	}
+	if _, ok := nfkdTable[r]; ok {
+		return false
+	}
+	if r >= hangulSBase && r < hangulSBase+hangulSCount {
+		// 韩文音节本身是合成形式，但可能跟后面的字母继续合成
+		return (r-hangulSBase)%hangulTCount != 0
+	}
+	if r >= hangulLBase && r < hangulTBase+hangulTCount {
+		return false
+	}
+	return combiningClass(r) == 0 && !composeSecond[r]
+}
+
+// NFKC规范化：完全兼容分解，按规范组合类排序，再做规范合成
+func (b *foldBuffer) nfkc(s string) string {
+	stable := true
+	for _, r := range s {
+		if !nfkcStable(r) {
+			stable = false
+			break
+		}
+	}
+	if stable {
+		return s
+	}
+
+	runes := b.runes[:0]
+	for _, r := range s {
+		runes = appendDecomposed(runes, r)
+	}
+	b.runes = runes
+	reorderCombining(runes)
+	out := b.output()
+	for _, r := range composeRunes(runes) {
+		out = appendRune(out, r)
+	}
+	return b.done(out)
+}
+
+func appendDecomposed(buf []rune, r rune) []rune {
+	if r >= hangulSBase && r < hangulSBase+hangulSCount {
+		s := r - hangulSBase
+		buf = append(buf, hangulLBase+s/hangulNCount, hangulVBase+(s%hangulNCount)/hangulTCount)
+		if t := s % hangulTCount; t != 0 {
+			buf = append(buf, hangulTBase+t)
+		}
+		return buf
+	}
+	if d, ok := nfkdTable[r]; ok {
+		for _, c := range d {
+			buf = append(buf, c)
+		}
+		return buf
+	}
+	return append(buf, r)
+}
+
+// 连续的组合字符按规范组合类稳定排序
+func reorderCombining(buf []rune) {
+	for i := 1; i < len(buf); i++ {
+		for j := i; j > 0; j-- {
+			cc := combiningClass(buf[j])
+			if cc == 0 || combiningClass(buf[j-1]) <= cc {
+				break
+			}
+			buf[j-1], buf[j] = buf[j], buf[j-1]
+		}
+	}
+}
+
+// 返回两个字符的规范合成结果
+func composePair(a, b rune) (rune, bool) {
+	// 韩文字母合成音节
+	if a >= hangulLBase && a < hangulLBase+hangulLCount && b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+(b-hangulVBase))*hangulTCount, true
+	}
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + (b - hangulTBase), true
+	}
+	c, ok := composeTable[[2]rune{a, b}]
+	return c, ok
+}
+
+// 规范合成，在buf上原地进行，返回合成后的切片
+func composeRunes(buf []rune) []rune {
+	if len(buf) == 0 {
+		return buf
+	}
+	starterPos := 0
+	lastClass := int(combiningClass(buf[0]))
+	if lastClass != 0 {
+		lastClass = 256 // 开头不是起始字符，后面的字符都不能跟它合成
+	}
+	n := 1
+	for i := 1; i < len(buf); i++ {
+		c := buf[i]
+		cc := int(combiningClass(c))
+		if composite, ok := composePair(buf[starterPos], c); ok && (lastClass < cc || lastClass == 0) {
+			buf[starterPos] = composite
+			continue
+		}
+		if cc == 0 {
+			starterPos = n
+		}
+		lastClass = cc
+		buf[n] = c
+		n++
+	}
+	return buf[:n]
+}
@@ -0,0 +1,272 @@
+package logexp
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// 各类叶子节点计算一次的相对开销，元表达式（strings.Contains）为1
+var leafCosts = map[ExpressionType]float64{
+	ExpressionType_Meta:        1,
+	ExpressionType_Anchor:      0.5,
+	ExpressionType_Compare:     2,
+	ExpressionType_Fuzzy:       4,
+	ExpressionType_Time:        6,
+	ExpressionType_Pinyin:      8,
+	ExpressionType_Placeholder: 0,
+}
+
+// 包外实现的叶子节点的开销
+const defaultLeafCost = 2
+
+// 一个叶子节点在样本中的命中情况
+type LeafStat struct {
+	Expression string `json:"expression"` // 叶子节点不取非时的文本形式
+	Hits       int    `json:"hits"`       // 命中的样本数
+	Samples    int    `json:"samples"`    // 计算过的样本数
+}
+
+/*
+ * 从样本语料中学习每个叶子节点的命中率，供Optimize估计选择度
+ * 叶子节点按不取非时的文本形式区分，所以不同表达式里相同的关键词共用统计数据
+ * Stats可以被多个goroutine并发使用
+ */
+type Stats struct {
+	mu     sync.RWMutex
+	leaves map[string]*LeafStat
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		leaves: make(map[string]*LeafStat),
+	}
+}
+
+/*
+ * 用一条样本文本计算表达式的所有叶子节点，记录它们是否命中
+ * 跟Match不同，不会短路求值
+ */
+func (s *Stats) Observe(exp *LogExp, text string) {
+	text = foldString(text, exp.fold)
+	leaves := make(map[string]bool)
+	Walk(exp.expression, leafHitCollector{text: text, hits: leaves})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, hit := range leaves {
+		stat, ok := s.leaves[key]
+		if !ok {
+			stat = &LeafStat{Expression: key}
+			s.leaves[key] = stat
+		}
+		stat.Samples++
+		if hit {
+			stat.Hits++
+		}
+	}
+}
+
+// 计算叶子节点是否命中的访问者，同一个叶子节点只计算一次
+type leafHitCollector struct {
+	text string
+	hits map[string]bool
+}
+
+func (c leafHitCollector) Enter(exp IExpression) bool {
+	if len(exp.GetExps()) == 0 {
+		leaf := withNegative(exp, false)
+		key := expressionString(leaf)
+		if _, ok := c.hits[key]; !ok {
+			c.hits[key] = leaf.Match(c.text)
+		}
+	}
+	return true
+}
+
+func (c leafHitCollector) Leave(exp IExpression) {}
+
+/*
+ * 返回叶子节点（不计取非）在样本中的命中率，没有样本时返回false
+ * 命中率做了拉普拉斯平滑，不会是0或者1
+ */
+func (s *Stats) Selectivity(leaf IExpression) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stat, ok := s.leaves[expressionString(withNegative(leaf, false))]
+	if !ok || stat.Samples == 0 {
+		return 0, false
+	}
+	return float64(stat.Hits+1) / float64(stat.Samples+2), true
+}
+
+// 返回所有叶子节点的统计数据，按文本形式排序
+func (s *Stats) Snapshot() []LeafStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]LeafStat, 0, len(s.leaves))
+	for _, stat := range s.leaves {
+		res = append(res, *stat)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Expression < res[j].Expression
+	})
+	return res
+}
+
+// 表达式的估计：命中的概率和计算一次的期望开销
+type estimate struct {
+	prob float64
+	cost float64
+}
+
+/*
+ * 按估计的开销和选择度重排“或”、“且”表达式的子表达式，返回新的树，原树不会被修改
+ * “且”表达式把最可能不通过且开销小的子表达式放在前面，“或”表达式把最可能通过且开销小的放在前面，这样短路求值最早结束
+ * 子表达式之间没有副作用，所以重排不改变匹配结果；顺序没有变化的子树被原样复用
+ * 被多处引用的同一个“或”、“且”表达式只重排一次，重排的结果在各处共用，所以指令序列中的子程序仍然只生成一次
+ * stats为nil时，只按叶子节点的类型和关键词长度估计
+ */
+func Optimize(exp IExpression, stats *Stats) IExpression {
+	o := optimizer{stats: stats, memo: make(map[IExpression]optimized)}
+	res, _ := o.optimize(exp)
+	return res
+}
+
+// 重排表达式时的状态
+type optimizer struct {
+	stats *Stats
+	memo  map[IExpression]optimized // 已经重排过的“或”、“且”表达式
+}
+
+type optimized struct {
+	exp IExpression
+	est estimate
+}
+
+func (o *optimizer) optimize(exp IExpression) (IExpression, estimate) {
+	group := isGroup(exp)
+	if group {
+		if res, ok := o.memo[exp]; ok {
+			return res.exp, res.est
+		}
+	}
+	res, est := o.reorder(exp)
+	if group {
+		o.memo[exp] = optimized{exp: res, est: est}
+	}
+	return res, est
+}
+
+func (o *optimizer) reorder(exp IExpression) (IExpression, estimate) {
+	stats := o.stats
+	exps := exp.GetExps()
+	if len(exps) == 0 {
+		est := estimateLeaf(exp, stats)
+		if exp.GetIsNegative() {
+			est.prob = 1 - est.prob
+		}
+		return exp, est
+	}
+	typ := exp.GetType()
+	newExps := make([]IExpression, len(exps))
+	ests := make([]estimate, len(exps))
+	changed := false
+	for i := range exps {
+		newExps[i], ests[i] = o.optimize(exps[i])
+		changed = changed || newExps[i] != exps[i]
+	}
+
+	// 只重排本包的“或”、“且”表达式
+	if typ == ExpressionType_And || typ == ExpressionType_Or {
+		order := make([]int, len(exps))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return rank(typ, ests[order[a]]) < rank(typ, ests[order[b]])
+		})
+		sorted := make([]IExpression, len(exps))
+		sortedEsts := make([]estimate, len(exps))
+		for i, j := range order {
+			sorted[i], sortedEsts[i] = newExps[j], ests[j]
+			changed = changed || j != i
+		}
+		newExps, ests = sorted, sortedEsts
+	}
+
+	// 短路求值的期望开销：第i个子表达式只有在前面的都没有结束求值时才会被计算
+	est := estimate{prob: 1, cost: 0}
+	reach := 1.0
+	miss := 1.0
+	for _, e := range ests {
+		est.cost += reach * e.cost
+		if typ == ExpressionType_Or {
+			reach *= 1 - e.prob
+			miss *= 1 - e.prob
+		} else {
+			reach *= e.prob
+			est.prob *= e.prob
+		}
+	}
+	if typ == ExpressionType_Or {
+		est.prob = 1 - miss
+	}
+	if exp.GetIsNegative() {
+		est.prob = 1 - est.prob
+	}
+
+	if !changed {
+		return exp, est
+	}
+	switch e := exp.(type) {
+	case *ExpressionAnd:
+		copied := *e
+		copied.Exps = newExps
+		return &copied, est
+	case *ExpressionOr:
+		copied := *e
+		copied.Exps = newExps
+		return &copied, est
+	}
+	// 包外实现的表达式无法替换子表达式
+	return exp, est
+}
+
+/*
+ * 排序的依据，越小越应该先计算
+ * “且”表达式按开销/不通过的概率排序，“或”表达式按开销/通过的概率排序，这个顺序使独立子表达式的期望开销最小
+ */
+func rank(typ ExpressionType, e estimate) float64 {
+	p := e.prob
+	if typ == ExpressionType_And {
+		p = 1 - p
+	}
+	if p <= 0 {
+		p = 1e-9
+	}
+	return e.cost / p
+}
+
+// 估计叶子节点（不计取非）命中的概率和开销
+func estimateLeaf(exp IExpression, stats *Stats) estimate {
+	cost, ok := leafCosts[exp.GetType()]
+	if !ok {
+		cost = defaultLeafCost
+	}
+	if stats != nil {
+		if prob, ok := stats.Selectivity(exp); ok {
+			return estimate{prob: prob, cost: cost}
+		}
+	}
+	// 没有统计数据时，认为关键词越长越少见
+	prob := 0.5
+	if meta, ok := exp.(*ExpressionMeta); ok {
+		prob = 1 / float64(1+utf8.RuneCountInString(meta.Keyword))
+	}
+	return estimate{prob: prob, cost: cost}
+}
+
+// 重排子表达式，返回新的LogExp，原LogExp不受影响
+func (e *LogExp) Optimize(stats *Stats) *LogExp {
+	return newLogExp(Optimize(e.expression, stats), e.fold)
+}
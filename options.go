@@ -0,0 +1,87 @@
+package logexp
+
+/*
+ * 编译选项
+ * 零值表示不做任何限制，跟Compile的行为一致；表达式来自不可信的输入时，应该设置各项上限
+ */
+type CompileOptions struct {
+	MaxLength   int // 表达式的最大长度（字符数），0表示不限制
+	MaxDepth    int // 表达式的最大嵌套层数，“或”、“且”表达式每嵌套一层加1，0表示不限制
+	MaxKeywords int // 关键词（元表达式）的最大个数，0表示不限制
+	MaxNodes    int // 编译过程中构造的表达式节点的最大个数，0表示不限制
+
+	Syntax Syntax // 启用的语法扩展，0表示只接受基础语法
+	Fold   Fold   // 关键词和文本在匹配前做的规范化，0表示按原样匹配
+
+	Pinyin PinyinMode  // 只由字母和空白组成的关键词还可以按拼音匹配汉字，0表示不启用
+	Time   TimeOptions // 时间表达式（Syntax_Time）解析时间戳的方式
+
+	Registry *Registry // 表达式中的@name引用的定义，nil表示不启用引用
+	Synonyms Synonyms  // 同义词词典，关键词被展开成关键词及其同义词的“或”表达式，nil表示不展开
+}
+
+// 编译过程中的状态，编译结束后即丢弃
+type parser struct {
+	opts      CompileOptions
+	keywords  int                   // 已经构造的元表达式个数
+	nodes     int                   // 已经构造的表达式节点个数
+	timeOpts  *TimeOptions          // 所有时间表达式共用的选项
+	expanding []string              // 正在展开的定义，用于检测循环引用
+	expanded  map[string]*expansion // 已经展开的定义
+	maxDepth  int                   // 已经到达的最大嵌套层数
+	template  bool                  // 是否在编译模板，模板中的{name}是占位符
+	literal   bool                  // 关键词是否来自模板的值：不检查其中的语法符号，含有语法符号时文本形式写成短语
+}
+
+// 编译一个完整的表达式：先把扩展语法翻译成基础语法，再从“或”表达式开始编译
+func (p *parser) compile(exp string) (IExpression, *CstError) {
+	return p.compileAt(exp, 1)
+}
+
+// 从给定的嵌套层数开始编译，用于展开嵌在表达式中的定义
+func (p *parser) compileAt(exp string, depth int) (IExpression, *CstError) {
+	runes := translateSyntax([]rune(exp), p.opts.Syntax)
+	return p.parseOr(runes, false, 0, depth)
+}
+
+// 开始编译一个“或”、“且”表达式，检查嵌套层数和节点数是否超限
+func (p *parser) enter(depth int) *CstError {
+	if cerr := p.reach(depth); cerr != nil {
+		return cerr
+	}
+	return p.addCost(1, 0)
+}
+
+// 开始编译一个元表达式，检查关键词数和节点数是否超限
+func (p *parser) enterMeta() *CstError {
+	return p.addCost(1, 1)
+}
+
+// 记录到达的嵌套层数，检查是否超限
+func (p *parser) reach(depth int) *CstError {
+	if p.opts.MaxDepth > 0 && depth > p.opts.MaxDepth {
+		return newCstError(ErrCodeTooDeep, "expression is nested deeper than %v levels", p.opts.MaxDepth)
+	}
+	if depth > p.maxDepth {
+		p.maxDepth = depth
+	}
+	return nil
+}
+
+// 累加节点数和关键词数，检查是否超限
+func (p *parser) addCost(nodes int, keywords int) *CstError {
+	p.keywords += keywords
+	if p.opts.MaxKeywords > 0 && p.keywords > p.opts.MaxKeywords {
+		return newCstError(ErrCodeTooManyKeywords, "expression has more than %v keywords", p.opts.MaxKeywords)
+	}
+	p.nodes += nodes
+	if p.opts.MaxNodes > 0 && p.nodes > p.opts.MaxNodes {
+		return newCstError(ErrCodeTooManyNodes, "expression has more than %v nodes", p.opts.MaxNodes)
+	}
+	return nil
+}
+
+// 对关键词做跟匹配时的文本相同的规范化
+func (p *parser) foldKeyword(keyword string) string {
+	return foldString(keyword, p.opts.Fold)
+}
@@ -0,0 +1,195 @@
+package logexp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type PinyinMode int32 // 用拼音书写的关键词匹配汉字的方式，可以按位组合，同时启用时每个汉字可以任选一种方式
+const (
+	PinyinMode_Full     PinyinMode = 1 << iota // 全拼，例如：zhifu shibai 匹配 支付失败
+	PinyinMode_Initials                        // 首字母，声母zh、ch、sh也可以写全，例如：zfsb 匹配 支付失败
+)
+
+// 汉字的读音，多音字有多个读音
+var pinyinTable = func() map[rune][]string {
+	res := make(map[rune][]string, 2048)
+	for _, item := range strings.Fields(pinyinDict) {
+		i := strings.IndexByte(item, ':')
+		syllable := item[:i]
+		for _, r := range item[i+1:] {
+			res[r] = append(res[r], syllable)
+		}
+	}
+	return res
+}()
+
+// 拼音表达式：用拼音书写的关键词，既按原样匹配，也按读音匹配汉字
+type ExpressionPinyin struct {
+	Type       ExpressionType `json:"type"`
+	IsNegative bool           `json:"is_negative"` // 是否取非
+	Keyword    string         `json:"keyword"`     // 关键词
+	Mode       PinyinMode     `json:"mode"`        // 匹配方式
+	syntax     Syntax         // 编译时的语法，决定文本形式中关键词的写法
+}
+
+func (e *ExpressionPinyin) GetIsNegative() bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionPinyin) GetType() ExpressionType {
+	return e.Type
+}
+
+func (e *ExpressionPinyin) GetExps() []IExpression {
+	return nil
+}
+
+func (e *ExpressionPinyin) Match(text string) bool {
+	res := strings.Contains(text, e.Keyword)
+	for i := 0; !res && i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		// 匹配必须从一个汉字开始，否则跟按原样匹配没有区别
+		if pinyinOf(r) != nil && e.matchFrom(text[i:], e.Keyword) {
+			res = true
+		}
+		i += size
+	}
+	if e.IsNegative {
+		res = !res
+	}
+	return res
+}
+
+// 判断text的前缀能否拼出整个pattern，pattern里的空白被忽略，不区分大小写；汉字按读音匹配，其他字符按原样匹配
+func (e *ExpressionPinyin) matchFrom(text string, pattern string) bool {
+	for len(pattern) > 0 && (pattern[0] == ' ' || pattern[0] == '\t') {
+		pattern = pattern[1:]
+	}
+	if len(pattern) == 0 {
+		return true
+	}
+	if len(text) == 0 {
+		return false
+	}
+	r, size := utf8.DecodeRuneInString(text)
+	readings := pinyinOf(r)
+	if readings == nil {
+		return r < utf8.RuneSelf && lowerASCII(byte(r)) == lowerASCII(pattern[0]) && e.matchFrom(text[size:], pattern[1:])
+	}
+	for _, reading := range readings {
+		if e.Mode&PinyinMode_Full != 0 {
+			if n := matchSyllable(pattern, reading); n > 0 && e.matchFrom(text[size:], pattern[n:]) {
+				return true
+			}
+		}
+		if e.Mode&PinyinMode_Initials != 0 {
+			// 声母zh、ch、sh写全或者只写第一个字母都可以
+			initial := initialOf(reading)
+			if n := matchSyllable(pattern, initial); n > 0 && e.matchFrom(text[size:], pattern[n:]) {
+				return true
+			}
+			if len(initial) > 1 && lowerASCII(pattern[0]) == initial[0] && e.matchFrom(text[size:], pattern[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 说明关键词按原样或按读音出现的位置
+func (e *ExpressionPinyin) explain(text string) string {
+	if i := strings.Index(text, e.Keyword); i >= 0 {
+		return fmt.Sprintf("found at offset %v", i)
+	}
+	for i, r := range text {
+		if pinyinOf(r) != nil && e.matchFrom(text[i:], e.Keyword) {
+			return fmt.Sprintf("found by pinyin at offset %v", i)
+		}
+	}
+	return "not found"
+}
+
+func (e *ExpressionPinyin) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionPinyin) String() string {
+	if e.IsNegative {
+		return "!" + quoteKeyword(e.Keyword, e.syntax)
+	}
+	return quoteKeyword(e.Keyword, e.syntax)
+}
+
+// 汉字的读音，繁体字按对应的简体字查找，不是汉字或者词典里没有时返回nil
+func pinyinOf(r rune) []string {
+	if r < utf8.RuneSelf {
+		return nil
+	}
+	if readings, ok := pinyinTable[r]; ok {
+		return readings
+	}
+	return pinyinTable[t2sRune(r)]
+}
+
+// 读音的声母，零声母的读音取第一个字母
+func initialOf(reading string) string {
+	if len(reading) >= 2 && reading[1] == 'h' && strings.IndexByte("zcs", reading[0]) >= 0 {
+		return reading[:2]
+	}
+	return reading[:1]
+}
+
+/*
+ * 判断pattern是否以syllable开头（不区分大小写），返回syllable在pattern中的长度，不匹配时返回0
+ * 词典里的ü记作v，书写时也可以用u代替
+ */
+func matchSyllable(pattern string, syllable string) int {
+	if len(pattern) < len(syllable) {
+		return 0
+	}
+	for i := 0; i < len(syllable); i++ {
+		c := lowerASCII(pattern[i])
+		if c != syllable[i] && !(syllable[i] == 'v' && c == 'u') {
+			return 0
+		}
+	}
+	return len(syllable)
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// 判断关键词能否当作拼音：只由ASCII字母和空白组成，且至少有一个字母
+func isPinyinKeyword(keyword string) bool {
+	hasLetter := false
+	for i := 0; i < len(keyword); i++ {
+		c := lowerASCII(keyword[i])
+		switch {
+		case 'a' <= c && c <= 'z':
+			hasLetter = true
+		case c == ' ' || c == '\t':
+		default:
+			return false
+		}
+	}
+	return hasLetter
+}
+
+// 构造拼音表达式
+func newPinyin(keyword string, isNegative bool, mode PinyinMode, syntax Syntax) IExpression {
+	return &ExpressionPinyin{
+		Type:       ExpressionType_Pinyin,
+		IsNegative: isNegative,
+		Keyword:    keyword,
+		Mode:       mode,
+		syntax:     syntax,
+	}
+}
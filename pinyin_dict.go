@@ -0,0 +1,47 @@
+package logexp
+
+// 拼音词典：每一项是“拼音:汉字”，以空白分隔；多音字在多个拼音下出现，ü记作v
+const pinyinDict = "" +
+	"a:啊阿吖 ai:爱哀挨埃癌矮艾碍隘唉蔼哎 an:安按暗岸案俺氨鞍庵 ang:昂肮 ao:奥傲澳熬凹袄懊翱 ba:八把吧爸巴拔霸坝疤芭扒捌叭靶 bai:白百败拜摆柏佰伯稗 " +
+	"ban:办半板版班般搬伴扮颁瓣斑拌绊扳 bang:帮棒榜膀绑磅傍邦谤 bao:包报保宝饱抱暴薄爆胞堡剥豹刨雹苞褒 bei:被北备背倍杯悲辈贝碑卑狈惫 ben:本奔笨 beng:崩泵蹦绷 " +
+	"bi:比必笔闭币毕避壁鼻彼碧逼臂毙蔽弊秘鄙庇辟 bian:边变便编遍辩扁辨鞭贬 biao:表标彪膘 bie:别憋瘪 bin:宾滨彬斌濒 bing:并病兵冰饼柄丙秉屏 " +
+	"bo:波播博拨薄伯泊玻剥勃脖驳搏菠铂舶 bu:不部步布补捕卜簿哺埠怖 ca:擦 cai:才采财材菜彩猜裁踩睬 can:参残餐惨蚕灿 cang:仓藏苍舱沧 cao:草操曹槽糙 ce:策测册侧厕 cen:参 " +
+	"ceng:层曾蹭 cha:查差插茶察叉岔诧搽 chai:拆差柴 chan:产缠馋铲颤蝉 chang:长常场厂唱肠偿尝畅倡敞昌 chao:超朝潮炒吵抄巢钞 che:车彻撤扯 chen:陈沉称晨尘臣衬趁 " +
+	"cheng:成城程称承乘诚呈惩撑秤澄橙 chi:吃持池迟尺齿赤翅斥耻痴驰匙 chong:冲重充虫崇宠 chou:抽仇愁丑臭筹酬绸瞅 chu:出处初除础储触楚厨畜锄 chuan:传船穿串川喘 " +
+	"chuang:创床窗闯疮 chui:吹垂锤 chun:春纯唇蠢 chuo:戳 ci:此次词磁刺辞雌慈瓷差 cong:从聪丛葱匆 cou:凑 cu:粗促醋簇 cuan:窜篡 cui:催脆翠摧 " +
+	"cun:存村寸 cuo:错措挫搓磋 da:大打达答搭 dai:带代待袋贷戴呆逮怠 dan:单但担蛋淡胆弹丹诞旦耽 dang:当党档荡挡 dao:到道导倒刀岛盗稻蹈悼 de:的得德地 dei:得 " +
+	"deng:等灯登邓瞪凳 di:地第底低敌帝弟递滴抵笛堤的 dian:点电店典垫殿淀颠 diao:调掉吊钓雕 die:跌爹叠碟蝶 ding:定顶订丁钉盯鼎 diu:丢 dong:动东冬懂洞冻栋 " +
+	"dou:都斗豆抖逗陡 du:度都读独毒督堵肚杜渡镀 duan:段断短端锻 dui:对队堆兑 dun:顿吨盾蹲 duo:多夺朵躲堕 e:额恶饿俄鹅扼 en:恩 er:而二儿耳尔 fa:发法罚乏伐阀 " +
+	"fan:反饭犯范翻凡繁返泛番烦帆 fang:方放房防访纺仿妨芳 fei:非费飞肥废肺匪 fen:分份粉纷奋愤坟 feng:风封丰峰锋疯奉逢缝 fo:佛 fou:否 " +
+	"fu:服复福府附夫父副富负付妇幅扶浮符腐肤辅抚覆赴傅腹弗拂伏俘氟辐斧俯釜赋缚 gai:该改概盖溉 gan:干感赶敢甘肝杆 gang:刚钢港岗纲 gao:高告搞稿糕 ge:个各格歌革哥隔割阁 gei:给 " +
+	"gen:根跟 geng:更耕 gong:工公共功供攻宫贡恭 gou:构够购沟狗勾 gu:古故顾固股鼓骨谷孤姑估 gua:挂瓜刮 guai:怪乖拐 guan:关管观官馆惯冠贯罐 guang:光广逛 " +
+	"gui:规贵归鬼柜轨桂跪 gun:滚棍 guo:国过果锅 ha:哈 hai:还海害孩 han:含汉寒喊汗旱函 hang:行航 hao:好号毫豪耗 he:和合何河盒核荷贺喝 hei:黑嘿 hen:很恨狠 " +
+	"heng:横恒衡 hong:红洪宏虹轰 hou:后候厚猴吼 hu:户护互湖呼虎忽胡乎糊 hua:话化花华画划滑 huai:坏怀 huan:换环还欢缓患幻唤 huang:黄皇荒慌 " +
+	"hui:会回汇恢灰挥辉毁惠慧 hun:混婚昏魂 huo:或活火获货伙祸 ji:机及记级计技基积集急即极几际济继纪季寄击激籍迹鸡挤奇辑忌剂系肌饥姬圾 jia:家加价假架甲佳夹嘉驾 " +
+	"jian:间件见建简检健减渐监坚鉴尖兼剪荐箭舰贱溅践 jiang:将讲江降奖酱蒋 jiao:交教较角叫脚觉焦胶郊骄 jie:接结界节解阶街借介届姐洁截揭劫捷 jin:进金今近尽仅紧禁劲津谨 " +
+	"jing:经精境京景警竞静镜井敬惊净径晶睛鲸 jiong:窘 jiu:就九久究旧酒救纠 ju:局据举具句剧巨居聚拒距菊 juan:卷捐 jue:决觉绝角掘 jun:军均君俊 ka:卡咖 kai:开凯 " +
+	"kan:看刊砍堪 kang:康抗扛 kao:考靠烤 ke:可科克客课刻渴颗壳 ken:肯恳 keng:坑 kong:空控孔恐 kou:口扣 ku:库苦哭酷裤 kua:跨夸 kuai:快块会筷 " +
+	"kuan:宽款 kuang:况矿狂框 kui:亏愧 kun:困 kuo:扩括阔 la:拉啦辣 lai:来赖 lan:蓝栏拦懒烂篮 lang:浪狼朗 lao:老劳 le:了乐 lei:类累雷泪 " +
+	"leng:冷 li:里理力利立离历例李礼丽粒厉励梨璃黎篱哩吏隶 lia:俩 lian:连联练脸恋链帘 liang:量两辆良亮粮梁凉 liao:了料疗 lie:列烈裂劣 lin:林临邻 " +
+	"ling:另领令零灵龄铃岭 liu:流六留刘柳 long:龙隆笼 lou:楼漏露 lu:路录陆露炉鲁 luan:乱 lun:论轮 luo:落罗络逻 lv:率律旅绿虑铝 lve:略 ma:吗妈马码麻骂 " +
+	"mai:买卖麦迈 man:满慢漫 mang:忙盲 mao:毛冒贸帽猫 me:么 mei:没每美妹煤 men:们门闷 meng:梦猛盟蒙 mi:密米秘迷 mian:面免棉眠 miao:秒苗描妙 mie:灭 " +
+	"min:民敏 ming:名明命鸣 miu:谬 mo:模末莫默磨摸没 mou:某谋 mu:目母木幕牧 na:那拿哪 nai:乃耐奶 nan:难南男 nao:脑闹 ne:呢 nei:内 neng:能 " +
+	"ni:你尼泥逆拟 nian:年念 niang:娘 niao:鸟 nin:您 ning:宁凝 niu:牛扭 nong:农弄浓 nu:努怒奴 nuan:暖 nuo:诺 nv:女 nve:虐 ou:欧偶 " +
+	"pa:怕爬 pai:派排拍牌 pan:判盘盼 pang:旁胖 pao:跑炮泡 pei:配培陪赔 pen:盆喷 peng:朋碰膨 pi:批皮匹疲 pian:片篇偏骗 piao:票漂飘 pin:品频贫拼 " +
+	"ping:平评凭瓶屏 po:破迫坡婆 pu:普铺扑朴 qi:其起期气器企七齐奇启汽旗骑妻弃 qia:恰 qian:前钱千签欠潜浅牵迁铅 qiang:强墙枪抢 qiao:桥巧敲悄 qie:且切 " +
+	"qin:亲勤侵琴秦 qing:情请清轻青庆晴 qiong:穷 qiu:求球秋 qu:区取去曲趣渠 quan:全权劝泉 que:确缺却 qun:群 ran:然燃染 rang:让 rao:绕扰 re:热 " +
+	"ren:人认任忍 reng:仍 ri:日 rong:容荣融溶 rou:肉柔 ru:如入乳 ruan:软 rui:锐瑞 run:润 ruo:若弱 sa:撒 sai:赛 san:三散 sang:桑 " +
+	"sao:扫 se:色 sen:森 sha:杀沙 shai:晒 shan:山善闪删衫 shang:上商伤尚 shao:少烧绍稍 she:设社射舍涉蛇 shei:谁 shen:身深神审申甚伸肾参 " +
+	"sheng:生声省胜升圣剩 shi:是时十事实使始式市世试示视势施师失识史石适室食士拾释饰湿诗狮尸虱驶誓逝 shou:手收受首授守售寿瘦 shu:数书术输属树熟述束鼠署叔舒殊梳疏蔬薯暑 shua:刷 " +
+	"shuai:帅衰率 shuan:栓 shuang:双 shui:水税睡 shun:顺 shuo:说 si:四思死司私丝斯似寺 song:送松宋颂诵耸 sou:搜 su:速素诉苏宿塑俗 suan:算酸 " +
+	"sui:随虽岁碎 sun:损孙 suo:所索锁缩 ta:他她它塔踏 tai:台太态泰 tan:谈探弹坦叹 tang:堂糖汤躺 tao:套讨逃桃 te:特 teng:腾疼 ti:提体题替梯 " +
+	"tian:天田填甜 tiao:条调跳 tie:铁贴 ting:听停庭厅挺 tong:同通统痛童铜筒桶捅 tou:头投透偷 tu:图突土途徒 tuan:团 tui:推退腿 tun:吞 tuo:脱托拖妥 " +
+	"wa:挖哇 wai:外 wan:完万晚玩湾碗 wang:网往王望忘 wei:为位未委维卫微围危尾伟味违威唯惟纬慰谓喂魏 wen:问文温闻稳 wo:我握 wu:无物务五午误武屋舞 " +
+	"xi:系息西希席习细吸析喜洗戏锡稀溪悉袭熄惜媳 xia:下夏吓峡 xian:现线先限显县险鲜闲仙 xiang:想向相项象乡详香 xiao:小效消校笑销晓孝萧 xie:写些协谢斜鞋血 xin:新信心辛欣 " +
+	"xing:行性型形星兴省 xiong:雄凶 xiu:修休秀 xu:需续许序须虚蓄绪叙徐 xuan:选宣旋 xue:学雪血 xun:训寻迅询讯 ya:压呀牙亚 yan:验研严言颜延沿眼演烟宴焰燕岩盐 " +
+	"yang:样阳养洋 yao:要药摇腰邀 ye:也业页夜爷叶 yi:一已以意易议义亿依医移异疑益衣仪宜遗椅艺译忆亦疫役抑 yin:因音银引印饮 ying:应营影英硬迎赢映颖 yong:用永勇拥 " +
+	"you:有由又优游油友右邮 yu:于与语余育预域鱼遇雨玉欲浴狱誉御 yuan:元原员院远源愿 yue:月越约乐 yun:运云允 za:杂咋砸 zai:在再载灾栽宰 zan:暂赞咱 zang:脏藏 " +
+	"zao:早造遭燥澡枣糟灶 ze:则责择泽 zen:怎 zeng:增曾赠 zha:扎炸渣闸眨榨诈 zhai:债摘宅窄寨斋 zhan:站展战占沾粘斩盏崭辗 zhang:长章张掌丈帐账胀障涨杖 " +
+	"zhao:找照招朝着赵召罩兆昭沼 zhe:这者着折哲浙遮蔗蛰 zhen:真针阵镇震振珍诊枕侦斟 zheng:正证政整争征症郑挣蒸睁筝 zhi:之只知至制支直指值止职治志纸质执置致智织植旨址枝汁脂秩滞殖帜 " +
+	"zhong:中种重钟终众忠仲肿 zhou:周州洲舟粥轴宙皱昼骤 zhu:主注住助祝著筑竹朱珠逐猪柱驻烛嘱铸 zhua:抓 zhuan:转专传砖赚撰 zhuang:状装庄壮撞桩 zhui:追坠缀 " +
+	"zhun:准谆 zhuo:卓着桌捉啄灼浊 zi:子自字资紫籽姿仔滋 zong:总宗综纵踪棕 zou:走奏揍 zu:组足族租祖阻 zuan:钻纂 zui:最嘴罪醉 zun:遵尊 zuo:作做坐左昨座佐 "
@@ -0,0 +1,258 @@
+package logexp
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opcode uint8 // 指令
+const (
+	opMeta        opcode = iota // acc = strings.Contains(text, keywords[arg])
+	opLeaf                      // acc = leaves[arg].Match(text)，其他类型的叶子节点，取非已经包含在Match里
+	opNot                       // acc = !acc
+	opJumpIfTrue                // acc为true时跳转到arg
+	opJumpIfFalse               // acc为false时跳转到arg
+	opCall                      // 执行从arg开始的子程序，acc = 子程序的结果
+	opReturn                    // 结束当前的子程序，返回acc
+)
+
+type instr struct {
+	op  opcode
+	arg int32
+}
+
+/*
+ * 表达式树编译成的指令序列，由一个只有一个累加器的小虚拟机执行
+ * “或”、“且”表达式的短路求值编译成条件跳转，元表达式直接调用strings.Contains，不经过接口调用
+ * 被多处引用的子表达式（例如展开多次的定义）只生成一次，编译成子程序，引用处用opCall调用，指令数跟表达式的节点数成正比
+ * 指令序列是只读的，可以被多个goroutine并发执行
+ */
+type program struct {
+	code     []instr
+	keywords []string
+	leaves   []IExpression
+}
+
+// 生成指令序列时的状态
+type emitter struct {
+	prog    *program
+	refs    map[IExpression]int // “或”、“且”表达式被引用的次数
+	entries map[IExpression]int // 已经生成的子程序的入口
+	pending []IExpression       // 等待生成的子程序
+	calls   map[int]IExpression // opCall指令的位置 -> 调用的子程序
+}
+
+func compileProgram(exp IExpression) *program {
+	em := &emitter{
+		prog:    &program{},
+		refs:    make(map[IExpression]int),
+		entries: make(map[IExpression]int),
+		calls:   make(map[int]IExpression),
+	}
+	em.count(exp)
+	em.emit(exp, true)
+	// 有子程序时，主程序以opReturn结束，子程序依次放在后面
+	if len(em.pending) > 0 {
+		em.prog.code = append(em.prog.code, instr{op: opReturn})
+	}
+	for len(em.pending) > 0 {
+		sub := em.pending[0]
+		em.pending = em.pending[1:]
+		em.entries[sub] = len(em.prog.code)
+		em.emit(sub, true)
+		em.prog.code = append(em.prog.code, instr{op: opReturn})
+	}
+	for pc, sub := range em.calls {
+		em.prog.code[pc].arg = int32(em.entries[sub])
+	}
+	return em.prog
+}
+
+// 统计“或”、“且”表达式被引用的次数，共用的子表达式只遍历一次
+func (em *emitter) count(exp IExpression) {
+	if !isGroup(exp) {
+		return
+	}
+	em.refs[exp]++
+	if em.refs[exp] > 1 {
+		return
+	}
+	exps := exp.GetExps()
+	for i := range exps {
+		em.count(exps[i])
+	}
+}
+
+// 本包实现的有子表达式的“或”、“且”表达式，只有它们可以作为map的键
+func isGroup(exp IExpression) bool {
+	switch exp.(type) {
+	case *ExpressionAnd, *ExpressionOr:
+		return len(exp.GetExps()) > 0
+	}
+	return false
+}
+
+/*
+ * @Param inline: 是否直接生成表达式本身的指令；为false时，被多处引用的表达式生成对子程序的调用
+ */
+func (em *emitter) emit(exp IExpression, inline bool) {
+	prog := em.prog
+	if !inline && isGroup(exp) && em.refs[exp] > 1 {
+		if _, ok := em.entries[exp]; !ok {
+			em.entries[exp] = -1
+			em.pending = append(em.pending, exp)
+		}
+		em.calls[len(prog.code)] = exp
+		prog.code = append(prog.code, instr{op: opCall})
+		return
+	}
+	exps := exp.GetExps()
+	typ := exp.GetType()
+	if len(exps) == 0 || (typ != ExpressionType_And && typ != ExpressionType_Or) {
+		if meta, ok := exp.(*ExpressionMeta); ok {
+			prog.code = append(prog.code, instr{op: opMeta, arg: int32(len(prog.keywords))})
+			prog.keywords = append(prog.keywords, meta.Keyword)
+			if meta.IsNegative {
+				prog.code = append(prog.code, instr{op: opNot})
+			}
+			return
+		}
+		// 其他叶子节点，以及包外实现的表达式
+		prog.code = append(prog.code, instr{op: opLeaf, arg: int32(len(prog.leaves))})
+		prog.leaves = append(prog.leaves, exp)
+		return
+	}
+	// “且”表达式遇到false、“或”表达式遇到true时，跳到表达式的末尾，此时acc就是表达式的结果
+	jump := opJumpIfFalse
+	if typ == ExpressionType_Or {
+		jump = opJumpIfTrue
+	}
+	jumps := make([]int, 0, len(exps)-1)
+	for i := range exps {
+		em.emit(exps[i], false)
+		if i < len(exps)-1 {
+			jumps = append(jumps, len(prog.code))
+			prog.code = append(prog.code, instr{op: jump})
+		}
+	}
+	for _, j := range jumps {
+		prog.code[j].arg = int32(len(prog.code))
+	}
+	if exp.GetIsNegative() {
+		prog.code = append(prog.code, instr{op: opNot})
+	}
+}
+
+func (prog *program) match(text string) bool {
+	return prog.exec(text, 0)
+}
+
+// 从pc开始执行，直到opReturn或者指令序列的末尾
+func (prog *program) exec(text string, pc int) bool {
+	acc := false
+	code := prog.code
+	for ; pc < len(code); pc++ {
+		in := code[pc]
+		switch in.op {
+		case opMeta:
+			acc = strings.Contains(text, prog.keywords[in.arg])
+		case opLeaf:
+			acc = prog.leaves[in.arg].Match(text)
+		case opNot:
+			acc = !acc
+		case opJumpIfTrue:
+			if acc {
+				pc = int(in.arg) - 1
+			}
+		case opJumpIfFalse:
+			if !acc {
+				pc = int(in.arg) - 1
+			}
+		case opCall:
+			acc = prog.exec(text, int(in.arg))
+		case opReturn:
+			return acc
+		}
+	}
+	return acc
+}
+
+// 关键词查找结果的备忘录中的状态
+const (
+	memoUnknown uint8 = iota // 还没有查找
+	memoFalse
+	memoTrue
+)
+
+/*
+ * 跟match相同，但是关键词的查找结果记在memo里，多个指令序列可以共用同一个memo
+ * ids[i]是keywords[i]在memo中的下标
+ */
+func (prog *program) matchMemo(text string, ids []int32, memo []uint8) bool {
+	return prog.execMemo(text, 0, ids, memo)
+}
+
+func (prog *program) execMemo(text string, pc int, ids []int32, memo []uint8) bool {
+	acc := false
+	code := prog.code
+	for ; pc < len(code); pc++ {
+		in := code[pc]
+		switch in.op {
+		case opMeta:
+			id := ids[in.arg]
+			switch memo[id] {
+			case memoUnknown:
+				acc = strings.Contains(text, prog.keywords[in.arg])
+				memo[id] = memoFalse
+				if acc {
+					memo[id] = memoTrue
+				}
+			case memoTrue:
+				acc = true
+			default:
+				acc = false
+			}
+		case opLeaf:
+			acc = prog.leaves[in.arg].Match(text)
+		case opNot:
+			acc = !acc
+		case opJumpIfTrue:
+			if acc {
+				pc = int(in.arg) - 1
+			}
+		case opJumpIfFalse:
+			if !acc {
+				pc = int(in.arg) - 1
+			}
+		case opCall:
+			acc = prog.execMemo(text, int(in.arg), ids, memo)
+		case opReturn:
+			return acc
+		}
+	}
+	return acc
+}
+
+// 指令序列的文本形式，用于调试
+func (prog *program) String() string {
+	var sb strings.Builder
+	for pc, in := range prog.code {
+		switch in.op {
+		case opMeta:
+			sb.WriteString(fmt.Sprintf("%3d meta %q\n", pc, prog.keywords[in.arg]))
+		case opLeaf:
+			sb.WriteString(fmt.Sprintf("%3d leaf %v\n", pc, expressionString(prog.leaves[in.arg])))
+		case opNot:
+			sb.WriteString(fmt.Sprintf("%3d not\n", pc))
+		case opJumpIfTrue:
+			sb.WriteString(fmt.Sprintf("%3d jump_if_true %v\n", pc, in.arg))
+		case opJumpIfFalse:
+			sb.WriteString(fmt.Sprintf("%3d jump_if_false %v\n", pc, in.arg))
+		case opCall:
+			sb.WriteString(fmt.Sprintf("%3d call %v\n", pc, in.arg))
+		case opReturn:
+			sb.WriteString(fmt.Sprintf("%3d return\n", pc))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package logexp
+
+// 竞态检测模式下sync.Pool会随机丢弃对象，不能断言不分配内存
+const raceEnabled = true
@@ -0,0 +1,317 @@
+package logexp
+
+import (
+	"sort"
+	"sync"
+)
+
+// 定义的引用前缀，例如@db_errors
+const refPrefix = "@"
+
+/*
+ * 具名子表达式的注册表，通过CompileOptions.Registry传给编译过程
+ * 表达式中的@name会被展开成名为name的定义，定义之间可以互相引用，循环引用时编译失败
+ * Registry可以被多个goroutine并发使用
+ */
+type Registry struct {
+	mu   sync.RWMutex
+	defs map[string]*definition
+	gen  uint64 // 每次修改定义时加一，Cache用它判断编译结果是否过期
+}
+
+// 一个定义，source和exp只有一个有值
+type definition struct {
+	source string      // 表达式文本，引用时按引用方的编译选项编译
+	exp    IExpression // 已经编译好的表达式，引用时复用
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		defs: make(map[string]*definition),
+	}
+}
+
+/*
+ * @Param name: 定义的名字，引用时写作@name
+ * @Param exp: 表达式字符串，在被引用时才编译，所以可以引用之后才定义的名字
+ */
+func (r *Registry) Define(name string, exp string) *CstError {
+	if !isKey(name) {
+		return newCstError(ErrCodeInvalidExpression, "invalid definition name: %v", name)
+	}
+	if exp == "" {
+		return newCstError(ErrCodeInvalidExpression, "invalid expression: %v", exp)
+	}
+	r.set(name, &definition{source: exp})
+	return nil
+}
+
+/*
+ * @Param name: 定义的名字，引用时写作@name
+ * @Param exp: 已经编译好的表达式，例如LogExp.GetExpression()，引用时复用；引用方设置了Fold时，关键词按引用方的Fold重新规范化
+ */
+func (r *Registry) DefineExpression(name string, exp IExpression) *CstError {
+	if !isKey(name) {
+		return newCstError(ErrCodeInvalidExpression, "invalid definition name: %v", name)
+	}
+	if exp == nil {
+		return newCstError(ErrCodeInvalidExpression, "expression of %v is nil", name)
+	}
+	r.set(name, &definition{exp: exp})
+	return nil
+}
+
+func (r *Registry) set(name string, def *definition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defs[name] = def
+	r.gen++
+}
+
+func (r *Registry) generation() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.gen
+}
+
+func (r *Registry) get(name string) (*definition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	def, ok := r.defs[name]
+	return def, ok
+}
+
+// 返回所有定义的名字，按字典序排列
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.defs))
+	for name := range r.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 一次编译中已经展开的定义
+type expansion struct {
+	exp      IExpression
+	nodes    int // 展开后的节点数
+	keywords int // 展开后的关键词数
+	depth    int // 展开后相对于引用处的嵌套层数
+}
+
+/*
+ * 解析对定义的引用@name
+ * 不是引用的写法时返回nil；名字没有定义或者存在循环引用时返回错误
+ * 定义跟写在括号里一样计入编译选项的各项上限：每次引用都按展开后的大小累加节点数和关键词数，嵌套层数从引用处开始计算
+ * @Param depth: 引用所在的“或”、“且”表达式的嵌套层数
+ */
+func (p *parser) parseRef(exp string, isNegative bool, depth int) (IExpression, *CstError) {
+	if p.opts.Registry == nil || len(exp) <= len(refPrefix) || exp[:len(refPrefix)] != refPrefix || !isKey(exp[len(refPrefix):]) {
+		return nil, nil
+	}
+	name := exp[len(refPrefix):]
+	def, ok := p.opts.Registry.get(name)
+	if !ok {
+		return nil, newCstError(ErrCodeUndefinedName, "undefined name: %v", exp)
+	}
+	// 同一次编译中，同一个定义只展开一次，之后的引用共用展开的结果，但是仍然计入上限
+	ex, ok := p.expanded[name]
+	if !ok {
+		var cerr *CstError
+		if ex, cerr = p.expand(name, def, depth); cerr != nil {
+			return nil, cerr
+		}
+		if p.expanded == nil {
+			p.expanded = make(map[string]*expansion)
+		}
+		p.expanded[name] = ex
+	} else {
+		if cerr := p.reach(depth + ex.depth); cerr != nil {
+			return nil, cerr
+		}
+		if cerr := p.addCost(ex.nodes, ex.keywords); cerr != nil {
+			return nil, cerr
+		}
+	}
+	sub := ex.exp
+	if isNegative {
+		return withNegative(sub, !sub.GetIsNegative()), nil
+	}
+	return sub, nil
+}
+
+// 第一次展开定义，展开的开销已经计入上限
+func (p *parser) expand(name string, def *definition, depth int) (*expansion, *CstError) {
+	if def.exp != nil {
+		ex := &expansion{exp: def.exp}
+		ex.nodes, ex.keywords, ex.depth = measure(def.exp, make(map[IExpression]expansion))
+		if p.opts.Fold != 0 {
+			sub, cerr := p.refold(def.exp, make(map[IExpression]IExpression))
+			if cerr != nil {
+				return nil, cerr
+			}
+			ex.exp = sub
+		}
+		if cerr := p.reach(depth + ex.depth); cerr != nil {
+			return nil, cerr
+		}
+		if cerr := p.addCost(ex.nodes, ex.keywords); cerr != nil {
+			return nil, cerr
+		}
+		return ex, nil
+	}
+	for i := range p.expanding {
+		if p.expanding[i] == name {
+			return nil, newCstError(ErrCodeCircularDefinition, "circular definition: %v", cyclePath(p.expanding[i:], name))
+		}
+	}
+	if p.opts.MaxLength > 0 && len([]rune(def.source)) > p.opts.MaxLength {
+		return nil, newCstError(ErrCodeTooLong, "definition of %v is longer than %v characters", refPrefix+name, p.opts.MaxLength)
+	}
+	nodes, keywords, maxDepth := p.nodes, p.keywords, p.maxDepth
+	p.maxDepth = depth
+	p.expanding = append(p.expanding, name)
+	// 定义相当于写在括号里，比引用处深一层
+	sub, cerr := p.compileAt(def.source, depth+1)
+	p.expanding = p.expanding[:len(p.expanding)-1]
+	if cerr != nil {
+		return nil, cerr
+	}
+	ex := &expansion{
+		exp:      sub,
+		nodes:    p.nodes - nodes,
+		keywords: p.keywords - keywords,
+		depth:    p.maxDepth - depth,
+	}
+	if maxDepth > p.maxDepth {
+		p.maxDepth = maxDepth
+	}
+	return ex, nil
+}
+
+/*
+ * 按引用方的Fold重新规范化编译好的表达式中的关键词，否则关键词跟规范化后的文本对不上
+ * 关键词没有变化的节点原样复用；共用的子树只处理一次
+ */
+func (p *parser) refold(exp IExpression, memo map[IExpression]IExpression) (IExpression, *CstError) {
+	switch e := exp.(type) {
+	case *ExpressionMeta:
+		keyword := p.foldKeyword(e.Keyword)
+		if keyword == e.Keyword {
+			return e, nil
+		}
+		if cerr := p.checkKeyword(keyword); cerr != nil {
+			return nil, cerr
+		}
+		res := *e
+		res.Keyword = keyword
+		return &res, nil
+	case *ExpressionAnchor:
+		keyword := p.foldKeyword(e.Keyword)
+		if keyword == e.Keyword {
+			return e, nil
+		}
+		if cerr := p.checkKeyword(keyword); cerr != nil {
+			return nil, cerr
+		}
+		res := *e
+		res.Keyword = keyword
+		return &res, nil
+	case *ExpressionFuzzy:
+		if p.foldKeyword(e.Keyword) == e.Keyword {
+			return e, nil
+		}
+		return p.newFuzzy(e.Keyword, e.IsNegative, e.Distance)
+	case *ExpressionPinyin:
+		// 拼音关键词只有ASCII字母和空白，规范化之后仍然是拼音关键词
+		keyword := p.foldKeyword(e.Keyword)
+		if keyword == e.Keyword {
+			return e, nil
+		}
+		res := *e
+		res.Keyword = keyword
+		return &res, nil
+	case *ExpressionCompare:
+		key := p.foldKeyword(e.Key)
+		if key == e.Key {
+			return e, nil
+		}
+		if !isKey(key) {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid key after folding: %v", e.Key)
+		}
+		res := *e
+		res.Key = key
+		return &res, nil
+	case *ExpressionAnd, *ExpressionOr:
+		if res, ok := memo[exp]; ok {
+			return res, nil
+		}
+		exps := exp.GetExps()
+		var newExps []IExpression // 有子表达式发生变化时才分配
+		for i := range exps {
+			sub, cerr := p.refold(exps[i], memo)
+			if cerr != nil {
+				return nil, cerr
+			}
+			if newExps == nil && sub != exps[i] {
+				newExps = make([]IExpression, i, len(exps))
+				copy(newExps, exps[:i])
+			}
+			if newExps != nil {
+				newExps = append(newExps, sub)
+			}
+		}
+		res := exp
+		if newExps != nil {
+			res = newGroup(exp.GetType(), newExps, exp.GetIsNegative())
+		}
+		memo[exp] = res
+		return res, nil
+	}
+	// 时间、占位符以及包外实现的表达式没有关键词，原样使用
+	return exp, nil
+}
+
+/*
+ * 统计编译好的表达式展开后的节点数、关键词数和嵌套层数，跟编译时的计数方式一致：每个叶子节点算一个关键词
+ * 共用的子树按出现的次数计数，但是只遍历一次
+ */
+func measure(exp IExpression, memo map[IExpression]expansion) (int, int, int) {
+	exps := exp.GetExps()
+	if len(exps) == 0 {
+		return 1, 1, 0
+	}
+	// 只有本包的“或”、“且”表达式可以作为map的键
+	_, isAnd := exp.(*ExpressionAnd)
+	_, isOr := exp.(*ExpressionOr)
+	if isAnd || isOr {
+		if m, ok := memo[exp]; ok {
+			return m.nodes, m.keywords, m.depth
+		}
+	}
+	nodes, keywords, depth := 1, 0, 0
+	for i := range exps {
+		n, k, d := measure(exps[i], memo)
+		nodes += n
+		keywords += k
+		if d > depth {
+			depth = d
+		}
+	}
+	depth++
+	if isAnd || isOr {
+		memo[exp] = expansion{nodes: nodes, keywords: keywords, depth: depth}
+	}
+	return nodes, keywords, depth
+}
+
+// 循环引用的路径，例如@a -> @b -> @a
+func cyclePath(names []string, name string) string {
+	path := ""
+	for _, n := range names {
+		path += refPrefix + n + " -> "
+	}
+	return path + refPrefix + name
+}
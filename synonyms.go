@@ -0,0 +1,92 @@
+package logexp
+
+import (
+	"bufio"
+	"strings"
+)
+
+/*
+ * 同义词词典：关键词 -> 同义词
+ * 编译时，等于某个关键词的元表达式被展开成关键词及其所有同义词组成的“或”表达式，例如oom展开成oom|out of memory|OutOfMemoryError
+ * 展开只做一层，同义词本身不再展开
+ */
+type Synonyms map[string][]string
+
+/*
+ * 添加一组互为同义词的词，组内的每个词都会展开成整组词
+ */
+func (s Synonyms) AddGroup(words ...string) {
+	for _, word := range words {
+		for _, synonym := range words {
+			if synonym != word && !containsString(s[word], synonym) {
+				s[word] = append(s[word], synonym)
+			}
+		}
+	}
+}
+
+/*
+ * 解析文本形式的同义词词典，每行一条，空行和以'#'开头的行被忽略：
+ *   oom => out of memory, OutOfMemoryError   单向：只有oom会被展开
+ *   timeout, timed out, 超时                  双向：一组互为同义词的词
+ */
+func ParseSynonyms(text string) (Synonyms, *CstError) {
+	s := make(Synonyms)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, "=>"); i >= 0 {
+			keyword := strings.TrimSpace(line[:i])
+			synonyms := splitSynonyms(line[i+2:])
+			if keyword == "" || strings.Contains(keyword, ",") || len(synonyms) == 0 {
+				return nil, newCstError(ErrCodeInvalidExpression, "invalid synonyms at line %v: %v", lineNo, line)
+			}
+			for _, synonym := range synonyms {
+				if synonym != keyword && !containsString(s[keyword], synonym) {
+					s[keyword] = append(s[keyword], synonym)
+				}
+			}
+			continue
+		}
+		words := splitSynonyms(line)
+		if len(words) < 2 {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid synonyms at line %v: %v", lineNo, line)
+		}
+		s.AddGroup(words...)
+	}
+	return s, nil
+}
+
+// 按','拆分同义词，去掉两侧的空白和空的词
+func splitSynonyms(s string) []string {
+	words := make([]string, 0)
+	for _, word := range strings.Split(s, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func containsString(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 关键词的同义词，关键词先按原样查找，找不到时再按规范化之后的形式查找
+func (p *parser) synonymsOf(keyword string) []string {
+	if len(p.opts.Synonyms) == 0 {
+		return nil
+	}
+	if synonyms, ok := p.opts.Synonyms[keyword]; ok {
+		return synonyms
+	}
+	return p.opts.Synonyms[p.foldKeyword(keyword)]
+}
@@ -0,0 +1,265 @@
+package logexp
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Syntax int32 // 可选的语法扩展，可以按位组合
+const (
+	Syntax_WordOperators   Syntax = 1 << iota // AND、OR、NOT关键字运算符，不区分大小写，例如：error AND NOT timeout
+	Syntax_DoubledSymbols                     // 双写的运算符&&、||，例如：error && !timeout
+	Syntax_PrefixModifiers                    // Lucene风格的前缀修饰符：-term表示取非，+term表示必须出现，例如：error -timeout
+	Syntax_ImplicitAnd                        // 搜索引擎风格：忽略运算符两侧的空白，以空白分隔的词之间是“且”的关系，双引号括起来的短语保留内部的空白和符号，例如：payment "time out" | 超时
+	Syntax_FullWidth                          // 把全角及其他形似的字符当作对应的运算符，例如：（支付｜退款）＆！超时
+	Syntax_Fuzzy                              // 模糊关键词：keyword~N匹配跟关键词的编辑距离不超过N的子串，例如：paymnet~1 匹配 payment
+	Syntax_Compare                            // 数值比较：从文本中取出键对应的数值做比较，例如：latency>500、status:[500 TO 599]
+	Syntax_Time                               // 时间范围：从文本中解析出时间戳做比较，例如：@time>=2026-10-01T00:00:00Z、@time in last 15m
+	Syntax_Anchors                            // 锚定：^keyword匹配行首，keyword$匹配行尾，=keyword匹配整行，例如：^GET&.json$
+)
+
+// 形似运算符的字符及其对应的运算符
+var lookalikeOperators = map[rune]rune{
+	'（': '(', '﹙': '(', '⁽': '(', '₍': '(',
+	'）': ')', '﹚': ')', '⁾': ')', '₎': ')',
+	'｜': '|', '∣': '|', '￨': '|', 'ǀ': '|',
+	'＆': '&', '﹠': '&',
+	'！': '!', '﹗': '!', 'ǃ': '!',
+}
+
+// 形似双引号的字符，在Syntax_ImplicitAnd下用作短语的引号
+var lookalikeQuotes = map[rune]bool{
+	'＂': true, '“': true, '”': true,
+}
+
+// 关键字运算符及其对应的符号
+var wordOperators = []struct {
+	word string
+	op   rune
+}{
+	{"AND", '&'},
+	{"OR", '|'},
+	{"NOT", '!'},
+}
+
+/*
+ * 把扩展语法翻译成基础语法（只有'|'、'&'、'!'、'('、')'），翻译后的表达式交给原有的编译流程
+ * 被翻译的运算符两侧的空白会被去掉，其余空白仍然属于关键词的一部分
+ */
+func translateSyntax(exp []rune, syntax Syntax) []rune {
+	if syntax == 0 {
+		return exp
+	}
+	if syntax&Syntax_FullWidth != 0 {
+		exp = foldLookalikes(exp, syntax)
+	}
+	out := make([]rune, 0, len(exp))
+	for i := 0; i < len(exp); {
+		c := exp[i]
+
+		if syntax&Syntax_ImplicitAnd != 0 {
+			// 短语原样保留，交给编译流程处理
+			if c == '"' {
+				end := skipPhrase(exp, i)
+				out = append(out, exp[i:end]...)
+				i = end
+				continue
+			}
+			// 区间和相对时间窗口内的空白属于它们本身
+			if syntax&(Syntax_Compare|Syntax_Time) != 0 && (c == '[' || c == '{') {
+				end := skipRange(exp, i)
+				out = append(out, exp[i:end]...)
+				i = end
+				continue
+			}
+			if syntax&Syntax_Time != 0 && isWordStart(exp, i) {
+				if end := skipTimeWindow(exp, i); end > i {
+					out = append(out, exp[i:end]...)
+					i = end
+					continue
+				}
+			}
+			// 空白本身被忽略，如果它分隔了两个词，那么补上'&'
+			if unicode.IsSpace(c) {
+				i = skipSpace(exp, i)
+				if i < len(exp) && !atTermStart(out) && !atOperator(exp, i, syntax) {
+					out = append(out, '&')
+				}
+				continue
+			}
+		}
+
+		// 双写的运算符
+		if syntax&Syntax_DoubledSymbols != 0 && (c == '&' || c == '|') && i+1 < len(exp) && exp[i+1] == c {
+			out = appendOperator(out, c)
+			i = skipSpace(exp, i+2)
+			continue
+		}
+
+		// 关键字运算符
+		if syntax&Syntax_WordOperators != 0 && isWordStart(exp, i) {
+			if op, n := matchWordOperator(exp, i); n > 0 {
+				if op == '!' && !atTermStart(out) {
+					// "a NOT b" 等价于 "a AND NOT b"
+					out = appendOperator(out, '&')
+				}
+				out = appendOperator(out, op)
+				i = skipSpace(exp, i+n)
+				continue
+			}
+		}
+
+		// 前缀修饰符
+		if syntax&Syntax_PrefixModifiers != 0 && (c == '-' || c == '+') && isWordStart(exp, i) &&
+			i+1 < len(exp) && !unicode.IsSpace(exp[i+1]) && !strings.ContainsRune("|&)", exp[i+1]) {
+			if !atTermStart(out) {
+				// 紧跟在另一个词后面的修饰符，表示跟前面的词是“且”的关系
+				out = appendOperator(out, '&')
+			}
+			if c == '-' {
+				out = append(out, '!')
+			}
+			i++
+			continue
+		}
+
+		out = append(out, c)
+		i++
+	}
+	return out
+}
+
+// 把形似运算符的字符替换成对应的运算符，短语内的字符保持不变
+func foldLookalikes(exp []rune, syntax Syntax) []rune {
+	out := make([]rune, 0, len(exp))
+	for i := 0; i < len(exp); i++ {
+		c := exp[i]
+		if syntax&Syntax_ImplicitAnd != 0 && (c == '"' || lookalikeQuotes[c]) {
+			// 短语的开闭引号统一成'"'，内部原样保留
+			out = append(out, '"')
+			for i++; i < len(exp); i++ {
+				c = exp[i]
+				if c == '\\' && i+1 < len(exp) {
+					out = append(out, c, exp[i+1])
+					i++
+					continue
+				}
+				if c == '"' || lookalikeQuotes[c] {
+					out = append(out, '"')
+					break
+				}
+				out = append(out, c)
+			}
+			continue
+		}
+		if op, ok := lookalikeOperators[c]; ok {
+			c = op
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// 跳过从位置i开始的短语，返回短语结束之后的位置；短语内可以用'\\'转义'"'和'\\'
+func skipPhrase(exp []rune, i int) int {
+	for i++; i < len(exp); i++ {
+		switch exp[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(exp)
+}
+
+// 跳过从位置i开始的数值区间，返回区间结束之后的位置
+func skipRange(exp []rune, i int) int {
+	for i++; i < len(exp); i++ {
+		if exp[i] == ']' || exp[i] == '}' {
+			return i + 1
+		}
+	}
+	return len(exp)
+}
+
+// 判断位置i开始的是否是一个二元运算符或者右括号，它们前面不需要补'&'
+func atOperator(exp []rune, i int, syntax Syntax) bool {
+	if strings.ContainsRune("|&)", exp[i]) {
+		return true
+	}
+	if syntax&Syntax_WordOperators != 0 {
+		if op, n := matchWordOperator(exp, i); n > 0 && op != '!' {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析双引号括起来的短语，返回去掉引号和转义之后的文本，不是合法的短语时返回false
+func unquotePhrase(exp []rune) (string, bool) {
+	if len(exp) < 3 || exp[0] != '"' || exp[len(exp)-1] != '"' {
+		return "", false
+	}
+	buf := make([]rune, 0, len(exp)-2)
+	for i := 1; i < len(exp)-1; i++ {
+		c := exp[i]
+		if c == '\\' {
+			i++
+			if i == len(exp)-1 { // 结尾的引号被转义了，短语没有闭合
+				return "", false
+			}
+			c = exp[i]
+		} else if c == '"' {
+			return "", false
+		}
+		buf = append(buf, c)
+	}
+	return string(buf), true
+}
+
+// 追加运算符，运算符左侧的空白被去掉
+func appendOperator(out []rune, op rune) []rune {
+	for len(out) > 0 && unicode.IsSpace(out[len(out)-1]) {
+		out = out[:len(out)-1]
+	}
+	return append(out, op)
+}
+
+func skipSpace(exp []rune, i int) int {
+	for i < len(exp) && unicode.IsSpace(exp[i]) {
+		i++
+	}
+	return i
+}
+
+// 判断已经翻译的部分是否停在一个词的开头，即最后一个非空白字符是运算符、左括号，或者还没有任何字符
+func atTermStart(out []rune) bool {
+	for i := len(out) - 1; i >= 0; i-- {
+		if !unicode.IsSpace(out[i]) {
+			return strings.ContainsRune("(|&!", out[i])
+		}
+	}
+	return true
+}
+
+// 判断位置i是否是一个词的开头
+func isWordStart(exp []rune, i int) bool {
+	return i == 0 || unicode.IsSpace(exp[i-1]) || strings.ContainsRune("()|&!", exp[i-1])
+}
+
+// 判断位置i是否是一个词的结尾之后
+func isWordEnd(exp []rune, i int) bool {
+	return i == len(exp) || unicode.IsSpace(exp[i]) || strings.ContainsRune("()|&!", exp[i])
+}
+
+// 匹配位置i开始的关键字运算符，返回对应的符号和关键字的长度，不匹配时长度为0
+func matchWordOperator(exp []rune, i int) (rune, int) {
+	for _, w := range wordOperators {
+		n := len(w.word)
+		if i+n <= len(exp) && strings.EqualFold(string(exp[i:i+n]), w.word) && isWordEnd(exp, i+n) {
+			return w.op, n
+		}
+	}
+	return 0, 0
+}
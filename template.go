@@ -0,0 +1,138 @@
+package logexp
+
+import "sort"
+
+// 占位符表达式：模板中的{name}，实例化时替换成关键词；没有被替换的占位符不匹配任何文本
+type ExpressionPlaceholder struct {
+	Type       ExpressionType `json:"type"`
+	IsNegative bool           `json:"is_negative"` // 是否取非
+	Name       string         `json:"name"`        // 占位符的名字
+}
+
+func (e *ExpressionPlaceholder) GetIsNegative() bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionPlaceholder) GetType() ExpressionType {
+	return e.Type
+}
+
+func (e *ExpressionPlaceholder) GetExps() []IExpression {
+	return nil
+}
+
+func (e *ExpressionPlaceholder) Match(text string) bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionPlaceholder) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionPlaceholder) String() string {
+	if e.IsNegative {
+		return "!{" + e.Name + "}"
+	}
+	return "{" + e.Name + "}"
+}
+
+/*
+ * 带占位符的表达式模板，例如：{service}&(error|fatal)
+ * 模板只编译一次，每次实例化只替换占位符，不含占位符的子树在所有实例之间共用
+ * Template是只读的，可以被多个goroutine并发实例化
+ */
+type Template struct {
+	expression   IExpression
+	opts         CompileOptions
+	placeholders []string
+}
+
+func CompileTemplate(exp string) (*Template, *CstError) {
+	return CompileTemplateWithOptions(exp, CompileOptions{})
+}
+
+/*
+ * 编译模板，编译选项同时作用于实例化时替换进来的关键词（例如Fold）
+ */
+func CompileTemplateWithOptions(exp string, opts CompileOptions) (*Template, *CstError) {
+	runes := []rune(exp)
+	if opts.MaxLength > 0 && len(runes) > opts.MaxLength {
+		return nil, newCstError(ErrCodeTooLong, "expression is longer than %v characters", opts.MaxLength)
+	}
+	p := parser{opts: opts, template: true}
+	expression, cerr := p.compile(exp)
+	if cerr != nil {
+		return nil, cerr
+	}
+	names := make(map[string]bool)
+	Walk(expression, placeholderCollector(names))
+	placeholders := make([]string, 0, len(names))
+	for name := range names {
+		placeholders = append(placeholders, name)
+	}
+	sort.Strings(placeholders)
+	return &Template{
+		expression:   expression,
+		opts:         opts,
+		placeholders: placeholders,
+	}, nil
+}
+
+// 收集占位符名字的访问者
+type placeholderCollector map[string]bool
+
+func (c placeholderCollector) Enter(exp IExpression) bool {
+	if ph, ok := exp.(*ExpressionPlaceholder); ok {
+		c[ph.Name] = true
+	}
+	return true
+}
+
+func (c placeholderCollector) Leave(exp IExpression) {}
+
+// 返回模板中所有占位符的名字，按字典序排列
+func (t *Template) Placeholders() []string {
+	return append([]string(nil), t.placeholders...)
+}
+
+func (t *Template) String() string {
+	return expressionString(t.expression)
+}
+
+/*
+ * 用values替换占位符，生成可以匹配的LogExp
+ * 值按原样作为关键词，不会被当作表达式解析，所以其中的语法符号不需要转义；每个占位符都必须有非空的值
+ * 文本形式中，含有语法符号等的值写成短语，只有启用了短语语法（Syntax_ImplicitAnd）时才能重新编译得到同样的表达式
+ */
+func (t *Template) Instantiate(values map[string]string) (*LogExp, *CstError) {
+	p := parser{opts: t.opts, literal: true}
+	expression, cerr := Rewrite(t.expression, func(exp IExpression) (IExpression, *CstError) {
+		ph, ok := exp.(*ExpressionPlaceholder)
+		if !ok {
+			return exp, nil
+		}
+		value, ok := values[ph.Name]
+		if !ok || value == "" {
+			return nil, newCstError(ErrCodeMissingValue, "missing value for placeholder: {%v}", ph.Name)
+		}
+		return p.newMeta(value, ph.IsNegative)
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+	return newLogExp(expression, t.opts.Fold), nil
+}
+
+// 解析模板中的占位符{name}，不是占位符时返回nil
+func (p *parser) parsePlaceholder(exp string, isNegative bool) IExpression {
+	if !p.template || len(exp) < 3 || exp[0] != '{' || exp[len(exp)-1] != '}' || !isKey(exp[1:len(exp)-1]) {
+		return nil
+	}
+	return &ExpressionPlaceholder{
+		Type:       ExpressionType_Placeholder,
+		IsNegative: isNegative,
+		Name:       exp[1 : len(exp)-1],
+	}
+}
@@ -0,0 +1,479 @@
+package logexp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时间表达式的键
+const timeKey = "@time"
+
+// 相对时间窗口的写法：@time in last 15m
+const timeWindowPrefix = timeKey + " in last "
+
+/*
+ * 常见的时间戳格式
+ * Layouts为空时由内置的解析器识别这些格式（另外还接受2006/01/02T15:04:05、+0800形式的时区等，见parseISOTime）；
+ * Layouts设置为跟DefaultTimeLayouts相同的格式时，同样使用内置的解析器
+ */
+var DefaultTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+}
+
+// DefaultTimeLayouts原来的内容，用于判断Layouts是否就是默认的格式
+var defaultTimeLayouts = append([]string(nil), DefaultTimeLayouts...)
+
+// 时间表达式的选项
+type TimeOptions struct {
+	Layouts  []string         // 解析日志时间戳的格式，为空时识别常见的ISO 8601格式（见parseISOTime），由内置的解析器解析，不分配内存；其他格式使用time.Parse，可能分配内存
+	Field    string           // 时间戳所在的字段（key=value或者JSON字段），为空时取文本中第一个能解析的时间戳
+	Location *time.Location   // 不带时区的时间戳所在的时区，nil表示UTC
+	Now      func() time.Time // 当前时间，用于计算相对时间窗口，nil表示time.Now
+}
+
+// 按选项解析文本开头的时间戳；指定了默认格式以外的Layouts时使用time.Parse，解析失败时会分配内存
+func (o *TimeOptions) parse(s string) (time.Time, bool) {
+	if len(o.Layouts) == 0 || isDefaultLayouts(o.Layouts) {
+		return parseISOTime(s, o.location())
+	}
+	for _, layout := range o.Layouts {
+		if t, ok := parseTimeAt(s, layout, o.location()); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 是否跟DefaultTimeLayouts原来的内容相同，内置的解析器能识别所有这些格式
+func isDefaultLayouts(layouts []string) bool {
+	if len(layouts) != len(defaultTimeLayouts) {
+		return false
+	}
+	for i := range layouts {
+		if layouts[i] != defaultTimeLayouts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *TimeOptions) location() *time.Location {
+	if o.Location != nil {
+		return o.Location
+	}
+	return time.UTC
+}
+
+func (o *TimeOptions) now() time.Time {
+	if o.Now != nil {
+		return o.Now()
+	}
+	return time.Now()
+}
+
+/*
+ * 时间表达式：从文本中解析出时间戳，判断它是否在时间范围内，文本中没有时间戳时不匹配
+ * Last不为0时，时间范围是相对于匹配时的当前时间的窗口[now-Last, now]，否则由Min、Max确定
+ */
+type ExpressionTime struct {
+	Type         ExpressionType `json:"type"`
+	IsNegative   bool           `json:"is_negative"`   // 是否取非
+	Min          *time.Time     `json:"min"`           // 下界，nil表示没有下界
+	Max          *time.Time     `json:"max"`           // 上界，nil表示没有上界
+	ExclusiveMin bool           `json:"exclusive_min"` // 是否不包含下界
+	ExclusiveMax bool           `json:"exclusive_max"` // 是否不包含上界
+	Last         time.Duration  `json:"last"`          // 相对时间窗口的长度
+	opts         *TimeOptions
+}
+
+func (e *ExpressionTime) GetIsNegative() bool {
+	return e.IsNegative
+}
+
+func (e *ExpressionTime) GetType() ExpressionType {
+	return e.Type
+}
+
+func (e *ExpressionTime) GetExps() []IExpression {
+	return nil
+}
+
+func (e *ExpressionTime) Match(text string) bool {
+	res := false
+	if t, offset := e.timestamp(text); offset >= 0 {
+		res = e.inRange(t)
+	}
+	if e.IsNegative {
+		res = !res
+	}
+	return res
+}
+
+func (e *ExpressionTime) options() *TimeOptions {
+	if e.opts == nil {
+		// 不是通过编译构造的表达式
+		return &TimeOptions{}
+	}
+	return e.opts
+}
+
+func (e *ExpressionTime) inRange(t time.Time) bool {
+	if e.Last > 0 {
+		now := e.options().now()
+		return !t.Before(now.Add(-e.Last)) && !t.After(now)
+	}
+	if e.Min != nil && (t.Before(*e.Min) || e.ExclusiveMin && t.Equal(*e.Min)) {
+		return false
+	}
+	if e.Max != nil && (t.After(*e.Max) || e.ExclusiveMax && t.Equal(*e.Max)) {
+		return false
+	}
+	return true
+}
+
+// 解析文本中的时间戳，返回时间戳和它在文本中的位置，没有时间戳时位置返回-1
+func (e *ExpressionTime) timestamp(text string) (time.Time, int) {
+	opts := e.options()
+	if opts.Field != "" {
+		for start := 0; start < len(text); {
+			offset, j := findKey(text, start, opts.Field)
+			if offset < 0 {
+				break
+			}
+			if t, ok := parseFieldTime(text[j:], opts); ok {
+				return t, j
+			}
+			start = offset + len(opts.Field)
+		}
+		return time.Time{}, -1
+	}
+	// 时间戳从一个词的开头的数字开始
+	for i := 0; i < len(text); i++ {
+		if !isDigit(text[i]) || (i > 0 && !isTimeBoundary(text[i-1])) {
+			continue
+		}
+		if t, ok := opts.parse(text[i:]); ok {
+			return t, i
+		}
+	}
+	return time.Time{}, -1
+}
+
+func (e *ExpressionTime) withNegative(isNegative bool) IExpression {
+	exp := *e
+	exp.IsNegative = isNegative
+	return &exp
+}
+
+func (e *ExpressionTime) String() string {
+	var s string
+	switch {
+	case e.Last > 0:
+		s = timeWindowPrefix + formatDuration(e.Last)
+	case e.Min != nil && e.Max == nil:
+		s = timeKey + compareOp('>', e.ExclusiveMin) + e.Min.Format(time.RFC3339Nano)
+	case e.Min == nil && e.Max != nil:
+		s = timeKey + compareOp('<', e.ExclusiveMax) + e.Max.Format(time.RFC3339Nano)
+	default:
+		left, right := "[", "]"
+		if e.ExclusiveMin {
+			left = "{"
+		}
+		if e.ExclusiveMax {
+			right = "}"
+		}
+		s = timeKey + ":" + left + formatTimeBound(e.Min) + " TO " + formatTimeBound(e.Max) + right
+	}
+	if e.IsNegative {
+		return "!" + s
+	}
+	return s
+}
+
+// 说明解析到的时间戳
+func (e *ExpressionTime) explain(text string) string {
+	t, offset := e.timestamp(text)
+	if offset < 0 {
+		return "no timestamp"
+	}
+	if e.inRange(t) {
+		return fmt.Sprintf("timestamp %v at offset %v is in range", t.Format(time.RFC3339Nano), offset)
+	}
+	return fmt.Sprintf("timestamp %v at offset %v is out of range", t.Format(time.RFC3339Nano), offset)
+}
+
+func formatTimeBound(bound *time.Time) string {
+	if bound == nil {
+		return "*"
+	}
+	return bound.Format(time.RFC3339Nano)
+}
+
+// 时长的文本形式，去掉末尾为0的分、秒，例如15m而不是15m0s
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// 解析时长，除了time.ParseDuration支持的单位，还支持天，例如7d
+func parseWindow(s string) (time.Duration, bool) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || days <= 0 {
+			return 0, false
+		}
+		return time.Duration(days) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// 时间戳前面的字符，排除字母数字，避免从一个词的中间开始解析
+func isTimeBoundary(c byte) bool {
+	return !isDigit(c) && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z')
+}
+
+/*
+ * 按layout解析文本开头的时间戳
+ * 时间戳占用的词数跟layout相同，末尾的标点被去掉，例如"[2026-10-01 12:00:00]"中的时间戳
+ */
+func parseTimeAt(s string, layout string, loc *time.Location) (time.Time, bool) {
+	words := strings.Count(layout, " ") + 1
+	end := 0
+	for ; end < len(s); end++ {
+		if s[end] == ' ' || s[end] == '\t' {
+			words--
+			if words == 0 {
+				break
+			}
+		}
+	}
+	for end > 0 && strings.IndexByte(",;]})\"'", s[end-1]) >= 0 {
+		end--
+	}
+	t, err := time.ParseInLocation(layout, s[:end], loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// 解析字段中的时间戳，字段的值可以带引号，也可以是Unix时间戳（秒或毫秒）
+func parseFieldTime(s string, opts *TimeOptions) (time.Time, bool) {
+	if strings.HasPrefix(s, `"`) {
+		s = s[1:]
+		if end := strings.IndexByte(s, '"'); end >= 0 {
+			s = s[:end]
+		}
+	}
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	if n > 0 && (n == len(s) || isTimeBoundary(s[n]) && s[n] != '-' && s[n] != '/' && s[n] != ':' && s[n] != '.') {
+		unix, err := strconv.ParseInt(s[:n], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if n > 10 {
+			return time.Unix(0, unix*int64(time.Millisecond)).In(opts.location()), true
+		}
+		return time.Unix(unix, 0).In(opts.location()), true
+	}
+	return opts.parse(s)
+}
+
+/*
+ * 不分配内存地解析文本开头的ISO 8601风格的时间戳：
+ *   2006-01-02T15:04:05、2006-01-02 15:04:05、2006/01/02 15:04:05，可以带小数秒和时区（Z、+08:00、+0800）
+ * 时间戳后面只能是空白、文本末尾或者末尾的标点（例如"[2026-10-01 12:00:00]"），不带时区时按loc解析
+ */
+func parseISOTime(s string, loc *time.Location) (time.Time, bool) {
+	if len(s) < 19 {
+		return time.Time{}, false
+	}
+	year, ok1 := parseDigits(s[0:4])
+	month, ok2 := parseDigits(s[5:7])
+	day, ok3 := parseDigits(s[8:10])
+	hour, ok4 := parseDigits(s[11:13])
+	minute, ok5 := parseDigits(s[14:16])
+	sec, ok6 := parseDigits(s[17:19])
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6) ||
+		(s[4] != '-' && s[4] != '/') || s[7] != s[4] ||
+		(s[10] != 'T' && s[10] != 't' && s[10] != ' ') || s[13] != ':' || s[16] != ':' {
+		return time.Time{}, false
+	}
+	if month < 1 || month > 12 || day < 1 || day > daysIn(time.Month(month), year) || hour > 23 || minute > 59 || sec > 59 {
+		return time.Time{}, false
+	}
+	i := 19
+	// 小数秒，超过纳秒精度的部分被忽略
+	nsec := 0
+	if i+1 < len(s) && (s[i] == '.' || s[i] == ',') && isDigit(s[i+1]) {
+		i++
+		scale := int(time.Second)
+		for ; i < len(s) && isDigit(s[i]); i++ {
+			if scale > 1 {
+				scale /= 10
+				nsec += int(s[i]-'0') * scale
+			}
+		}
+	}
+	// 时区
+	hasZone, offset := false, 0
+	if i < len(s) && (s[i] == 'Z' || s[i] == 'z') {
+		hasZone = true
+		i++
+	} else if i+5 <= len(s) && (s[i] == '+' || s[i] == '-') {
+		// +08:00或者+0800
+		end := i + 5
+		minutes := s[i+3 : i+5]
+		if s[i+3] == ':' && i+6 <= len(s) {
+			end = i + 6
+			minutes = s[i+4 : i+6]
+		}
+		h, okh := parseDigits(s[i+1 : i+3])
+		m, okm := parseDigits(minutes)
+		if okh && okm && h <= 23 && m <= 59 {
+			hasZone = true
+			offset = (h*60 + m) * 60
+			if s[i] == '-' {
+				offset = -offset
+			}
+			i = end
+		}
+	}
+	for i < len(s) && strings.IndexByte(",;]})\"'", s[i]) >= 0 {
+		i++
+	}
+	if i < len(s) && s[i] != ' ' && s[i] != '\t' {
+		return time.Time{}, false
+	}
+	if !hasZone {
+		return time.Date(year, time.Month(month), day, hour, minute, sec, nsec, loc), true
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, sec, nsec, time.UTC)
+	return t.Add(-time.Duration(offset) * time.Second).In(loc), true
+}
+
+// 解析定长的十进制数字
+func parseDigits(s string) (int, bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// 一个月的天数
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// 解析表达式中的时间：RFC3339格式，或者只有日期2006-01-02
+func parseTimeBound(s string, loc *time.Location) (*time.Time, bool) {
+	if s == "*" {
+		return nil, true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+/*
+ * 解析时间表达式：@time>T、@time>=T、@time<T、@time<=T、@time:[T1 TO T2]，或者相对时间窗口@time in last 15m
+ * 不是以@time开头的比较、区间或者时间窗口时返回nil
+ */
+func (p *parser) parseTime(exp string, isNegative bool) (IExpression, *CstError) {
+	if !strings.HasPrefix(exp, timeWindowPrefix) &&
+		(len(exp) <= len(timeKey) || !strings.HasPrefix(exp, timeKey) || strings.IndexByte("<>:", exp[len(timeKey)]) < 0) {
+		return nil, nil
+	}
+	if p.timeOpts == nil {
+		opts := p.opts.Time
+		p.timeOpts = &opts
+	}
+	tm := ExpressionTime{
+		Type:       ExpressionType_Time,
+		IsNegative: isNegative,
+		opts:       p.timeOpts,
+	}
+	loc := p.timeOpts.location()
+	if strings.HasPrefix(exp, timeWindowPrefix) {
+		var ok bool
+		if tm.Last, ok = parseWindow(strings.TrimSpace(exp[len(timeWindowPrefix):])); !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid time window: %v", exp)
+		}
+		return &tm, nil
+	}
+	if key, rng, ok := splitRange(exp); ok && key == timeKey {
+		lower, upper, ok := parseRangeBounds(rng)
+		if !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid time range: %v", exp)
+		}
+		if tm.Min, ok = parseTimeBound(lower, loc); !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid time range: %v", exp)
+		}
+		if tm.Max, ok = parseTimeBound(upper, loc); !ok {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid time range: %v", exp)
+		}
+		tm.ExclusiveMin = rng[0] == '{'
+		tm.ExclusiveMax = rng[len(rng)-1] == '}'
+		return &tm, nil
+	}
+	if key, op, rest, ok := splitCompareOp(exp); ok && key == timeKey {
+		t, ok := parseTimeBound(rest, loc)
+		if !ok || t == nil {
+			return nil, newCstError(ErrCodeInvalidExpression, "invalid time: %v", exp)
+		}
+		switch op {
+		case ">":
+			tm.Min, tm.ExclusiveMin = t, true
+		case ">=":
+			tm.Min = t
+		case "<":
+			tm.Max, tm.ExclusiveMax = t, true
+		case "<=":
+			tm.Max = t
+		}
+		return &tm, nil
+	}
+	return nil, newCstError(ErrCodeInvalidExpression, "invalid time expression: %v", exp)
+}
+
+// 跳过从位置i开始的相对时间窗口，返回窗口结束之后的位置，不是相对时间窗口时返回i
+func skipTimeWindow(exp []rune, i int) int {
+	prefix := []rune(timeWindowPrefix)
+	if i+len(prefix) > len(exp) || string(exp[i:i+len(prefix)]) != timeWindowPrefix {
+		return i
+	}
+	end := i + len(prefix)
+	for end < len(exp) && !strings.ContainsRune(" \t|&)", exp[end]) {
+		end++
+	}
+	return end
+}
@@ -0,0 +1,64 @@
+#!/usr/bin/env python3
+"""Generate nfkc_tables.go from the Unicode database bundled with Python.
+
+Usage (from the repository root):
+    python3 tools/gen_nfkc_tables.py > nfkc_tables.go && gofmt -w nfkc_tables.go
+"""
+import unicodedata
+
+
+def runes(s):
+    return "".join("\\U%08X" % ord(c) if ord(c) > 0xFFFF else "\\u%04X" % ord(c) for c in s)
+
+
+def main():
+    decomp = []
+    ccc = []
+    compose = []
+    for c in range(0x110000):
+        if 0xD800 <= c <= 0xDFFF or 0xAC00 <= c <= 0xD7A3:
+            # 代理区不是字符，韩文音节按算法分解
+            continue
+        ch = chr(c)
+        nfkd = unicodedata.normalize("NFKD", ch)
+        if nfkd != ch:
+            decomp.append((c, nfkd))
+        cls = unicodedata.combining(ch)
+        if cls:
+            if ccc and ccc[-1][1] == c - 1 and ccc[-1][2] == cls:
+                ccc[-1] = (ccc[-1][0], c, cls)
+            else:
+                ccc.append((c, c, cls))
+        d = unicodedata.decomposition(ch)
+        if d and not d.startswith("<"):
+            parts = [int(p, 16) for p in d.split()]
+            if len(parts) == 2 and unicodedata.normalize("NFC", chr(parts[0]) + chr(parts[1])) == ch:
+                compose.append((parts[0], parts[1], c))
+
+    out = []
+    out.append("// Code generated by tools/gen_nfkc_tables.py from Unicode %s; DO NOT EDIT." % unicodedata.unidata_version)
+    out.append("")
+    out.append("package logexp")
+    out.append("")
+    out.append("// 完全兼容分解（NFKD），不包括按算法分解的韩文音节")
+    out.append("var nfkdTable = map[rune]string{")
+    for i in range(0, len(decomp), 4):
+        out.append("\t" + " ".join('0x%04X: "%s",' % (c, runes(s)) for c, s in decomp[i:i + 4]))
+    out.append("}")
+    out.append("")
+    out.append("// 非零的规范组合类，按码位升序排列的区间")
+    out.append("var cccTable = []cccRange{")
+    for i in range(0, len(ccc), 4):
+        out.append("\t" + " ".join("{0x%04X, 0x%04X, %d}," % r for r in ccc[i:i + 4]))
+    out.append("}")
+    out.append("")
+    out.append("// 规范合成，不包括合成排除的字符和韩文音节")
+    out.append("var composeTable = map[[2]rune]rune{")
+    for i in range(0, len(compose), 4):
+        out.append("\t" + " ".join("{0x%04X, 0x%04X}: 0x%04X," % r for r in compose[i:i + 4]))
+    out.append("}")
+    print("\n".join(out))
+
+
+if __name__ == "__main__":
+    main()
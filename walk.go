@@ -0,0 +1,174 @@
+package logexp
+
+// 遍历表达式树的访问者
+type Visitor interface {
+	/*
+	 * 进入节点时调用（先序），返回false则跳过该节点的子表达式，但仍会调用Leave
+	 */
+	Enter(exp IExpression) bool
+	/*
+	 * 离开节点时调用（后序）
+	 */
+	Leave(exp IExpression)
+}
+
+/*
+ * 深度优先遍历表达式树
+ * 被多处引用的同一个“或”、“且”表达式（例如展开多次的定义）只在第一次出现时访问，之后的出现连同子表达式一起跳过
+ */
+func Walk(exp IExpression, v Visitor) {
+	walk(exp, v, make(map[IExpression]bool))
+}
+
+func walk(exp IExpression, v Visitor, visited map[IExpression]bool) {
+	if isGroup(exp) {
+		if visited[exp] {
+			return
+		}
+		visited[exp] = true
+	}
+	if v.Enter(exp) {
+		exps := exp.GetExps()
+		for i := range exps {
+			walk(exps[i], v, visited)
+		}
+	}
+	v.Leave(exp)
+}
+
+/*
+ * 改写函数，返回替换后的节点
+ * 返回原节点表示不替换，返回nil表示从父表达式中删除该节点
+ */
+type RewriteFunc func(exp IExpression) (IExpression, *CstError)
+
+/*
+ * 自底向上改写表达式树，fn先作用于子表达式，再作用于父表达式
+ * 返回一棵新的树，原树不会被修改；子表达式都没有变化的节点会被原样复用
+ * 被多处引用的同一个“或”、“且”表达式只改写一次，改写的结果在各处共用
+ * 发生变化的组会重新展开同类型的子表达式，只剩一个子表达式时往上提
+ */
+func Rewrite(exp IExpression, fn RewriteFunc) (IExpression, *CstError) {
+	res, cerr := rewrite(exp, fn, make(map[IExpression]IExpression))
+	if cerr != nil {
+		return nil, cerr
+	}
+	if res == nil {
+		return nil, newCstError(ErrCodeInvalidExpression, "expression is empty after rewrite: %v", expressionString(exp))
+	}
+	return res, nil
+}
+
+func rewrite(exp IExpression, fn RewriteFunc, memo map[IExpression]IExpression) (IExpression, *CstError) {
+	group := isGroup(exp)
+	if group {
+		if res, ok := memo[exp]; ok {
+			return res, nil
+		}
+	}
+	res, cerr := rewriteNode(exp, fn, memo)
+	if cerr != nil {
+		return nil, cerr
+	}
+	if group {
+		memo[exp] = res
+	}
+	return res, nil
+}
+
+func rewriteNode(exp IExpression, fn RewriteFunc, memo map[IExpression]IExpression) (IExpression, *CstError) {
+	exps := exp.GetExps()
+	if len(exps) > 0 {
+		var newExps []IExpression // 有子表达式发生变化时才分配
+		for i := range exps {
+			sub, cerr := rewrite(exps[i], fn, memo)
+			if cerr != nil {
+				return nil, cerr
+			}
+			if newExps == nil && sub != exps[i] {
+				newExps = make([]IExpression, i, len(exps))
+				copy(newExps, exps[:i])
+			}
+			if newExps != nil && sub != nil {
+				newExps = append(newExps, sub)
+			}
+		}
+		if newExps != nil {
+			exp = newGroup(exp.GetType(), newExps, exp.GetIsNegative())
+			if exp == nil {
+				return nil, nil
+			}
+		}
+	}
+	return fn(exp)
+}
+
+/*
+ * 用给定的子表达式构造“或”、“且”表达式
+ * 跟编译时一样：同类型且不取非的子表达式直接展开；只有一个子表达式时往上提；没有子表达式时返回nil
+ */
+func newGroup(typ ExpressionType, exps []IExpression, isNegative bool) IExpression {
+	flat := make([]IExpression, 0, len(exps))
+	for i := range exps {
+		if exps[i].GetType() == typ && !exps[i].GetIsNegative() && len(exps[i].GetExps()) > 0 {
+			flat = append(flat, exps[i].GetExps()...)
+		} else {
+			flat = append(flat, exps[i])
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		if isNegative {
+			return withNegative(flat[0], !flat[0].GetIsNegative())
+		}
+		return flat[0]
+	}
+	if typ == ExpressionType_And {
+		return &ExpressionAnd{
+			Type:       ExpressionType_And,
+			IsNegative: isNegative,
+			Exps:       flat,
+		}
+	}
+	return &ExpressionOr{
+		Type:       ExpressionType_Or,
+		IsNegative: isNegative,
+		Exps:       flat,
+	}
+}
+
+// 可以复制出不同取非标记的副本的表达式
+type negatable interface {
+	withNegative(isNegative bool) IExpression
+}
+
+// 返回取非标记为isNegative的表达式，不修改原表达式
+func withNegative(exp IExpression, isNegative bool) IExpression {
+	if exp.GetIsNegative() == isNegative {
+		return exp
+	}
+	if n, ok := exp.(negatable); ok {
+		return n.withNegative(isNegative)
+	}
+	// 包外实现的表达式，用只有一个子表达式的“且”表达式包一层
+	return &ExpressionAnd{
+		Type:       ExpressionType_And,
+		IsNegative: true,
+		Exps:       []IExpression{exp},
+	}
+}
+
+func (e *LogExp) Walk(v Visitor) {
+	Walk(e.expression, v)
+}
+
+// 改写表达式，返回新的LogExp，原LogExp不受影响
+func (e *LogExp) Rewrite(fn RewriteFunc) (*LogExp, *CstError) {
+	expression, cerr := Rewrite(e.expression, fn)
+	if cerr != nil {
+		return nil, cerr
+	}
+	return newLogExp(expression, e.fold), nil
+}